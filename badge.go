@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BADGE_GREEN   = "#4c1"
+	BADGE_YELLOW  = "#dfb317"
+	BADGE_ORANGE  = "#fe7d37"
+	BADGE_RED     = "#e05d44"
+	BADGE_BLUE    = "#007ec6"
+	BADGE_NEUTRAL = "#9f9f9f"
+)
+
+const BADGE_DEFAULT_WINDOW = 30 * 24 * time.Hour
+
+func stateBadgeColor(state State) string {
+	switch state {
+	case STATE_UP:
+		return BADGE_GREEN
+	case STATE_DOWN:
+		return BADGE_RED
+	case STATE_DEGRADED:
+		return BADGE_ORANGE
+	case STATE_PAUSED:
+		return BADGE_BLUE
+	default:
+		return BADGE_NEUTRAL
+	}
+}
+
+func uptimeBadgeColor(ratio float64) string {
+	switch {
+	case ratio >= 0.99:
+		return BADGE_GREEN
+	case ratio >= 0.95:
+		return BADGE_YELLOW
+	case ratio >= 0.9:
+		return BADGE_ORANGE
+	default:
+		return BADGE_RED
+	}
+}
+
+// badgeTextWidth roughly estimates the width of text rendered in 11px
+// Verdana, which is good enough to size the badge.
+func badgeTextWidth(text string) int {
+	width := 0.0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune("iljtfI.,:;!|' ", r):
+			width += 4
+		case strings.ContainsRune("mwMW%@", r):
+			width += 10.5
+		case 'A' <= r && r <= 'Z':
+			width += 8
+		default:
+			width += 7
+		}
+	}
+
+	return int(width) + 10
+}
+
+// RenderBadge renders a flat, self-contained SVG badge.
+func RenderBadge(label, message, color string) []byte {
+	lw := badgeTextWidth(label)
+	mw := badgeTextWidth(message)
+	w := lw + mw
+
+	label = html.EscapeString(label)
+	message = html.EscapeString(message)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, w, label, message)
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, label, message)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, w)
+	b.WriteString(`<g clip-path="url(#r)">`)
+	fmt.Fprintf(&b, `<rect width="%d" height="20" fill="#555"/>`, lw)
+	fmt.Fprintf(&b, `<rect x="%d" width="%d" height="20" fill="%s"/>`, lw, mw, color)
+	fmt.Fprintf(&b, `<rect width="%d" height="20" fill="url(#s)"/>`, w)
+	b.WriteString(`</g>`)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, lw/2, label)
+	fmt.Fprintf(&b, `<text x="%d" y="14">%s</text>`, lw/2, label)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, lw+mw/2, message)
+	fmt.Fprintf(&b, `<text x="%d" y="14">%s</text>`, lw+mw/2, message)
+	b.WriteString(`</g></svg>`)
+
+	return b.Bytes()
+}
+
+// ParseWindow parses a time window, accepting days (e.g. "30d") on top of
+// the units supported by time.ParseDuration.
+func ParseWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window \"%s\"", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window \"%s\"", s)
+	}
+	return d, nil
+}
+
+// formatWindow is the inverse of ParseWindow, for badge labels.
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return d.String()
+}
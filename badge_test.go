@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+type emptySource struct{}
+
+func (this emptySource) Pings() []*Ping {
+	return nil
+}
+
+func TestUnknownBadge(t *testing.T) {
+	server, err := NewServer(&config.StatusPage{}, emptySource{})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	for _, path := range []string{"/badge/nope.svg", "/badge/nope/uptime.svg"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/svg+xml" {
+			t.Fatalf("%s: unexpected response %d", path, rec.Code)
+			return
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, ">unknown<") || !strings.Contains(body, BADGE_NEUTRAL) {
+			t.Fatalf("%s: expected a neutral badge, got %s", path, body)
+			return
+		}
+	}
+}
+
+func TestRenderBadgeEscapes(t *testing.T) {
+	svg := string(RenderBadge("a&b", "<ok>", BADGE_GREEN))
+	if strings.Contains(svg, "a&b") || strings.Contains(svg, "<ok>") {
+		t.Fatalf("badge text is not escaped: %s", svg)
+		return
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+	for s, expected := range cases {
+		d, err := ParseWindow(s)
+		if err != nil || d != expected {
+			t.Fatalf("%s: expected %v, got %v (%v)", s, expected, d, err)
+			return
+		}
+	}
+
+	for _, s := range []string{"", "d", "-1d", "abc"} {
+		_, err := ParseWindow(s)
+		if err == nil {
+			t.Fatalf("%s: expected an error", s)
+			return
+		}
+	}
+}
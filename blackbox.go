@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+	"gopkg.in/yaml.v3"
+)
+
+// BlackboxConfig is the config of the Prometheus blackbox exporter, which
+// defines how targets are probed but not the targets.
+type BlackboxConfig struct {
+	Modules map[string]BlackboxModule `yaml:"modules"`
+}
+
+type BlackboxModule struct {
+	Prober  string `yaml:"prober"`
+	Timeout string `yaml:"timeout,omitempty"`
+	// kept as is, so that avail import can report the unsupported settings
+	Http map[string]any `yaml:"http,omitempty"`
+}
+
+// BLACKBOX_DEFAULT_MODULES are the modules of the example config the
+// exporter ships with, used unless its config is passed.
+var BLACKBOX_DEFAULT_MODULES = map[string]BlackboxModule{
+	"http_2xx":      {Prober: "http"},
+	"http_post_2xx": {Prober: "http", Http: map[string]any{"method": "POST"}},
+	"tcp_connect":   {Prober: "tcp"},
+	"icmp":          {Prober: "icmp"},
+}
+
+// ReadBlackboxConfig parses the config of the blackbox exporter.
+func ReadBlackboxConfig(b []byte) (*BlackboxConfig, error) {
+	var ret BlackboxConfig
+	err := yaml.Unmarshal(b, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// PrometheusConfig is the part of the Prometheus config that defines the
+// targets probed through the blackbox exporter.
+type PrometheusConfig struct {
+	Global        *PrometheusGlobal `yaml:"global,omitempty"`
+	ScrapeConfigs []ScrapeConfig    `yaml:"scrape_configs"`
+}
+
+type PrometheusGlobal struct {
+	ScrapeInterval string `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout  string `yaml:"scrape_timeout,omitempty"`
+}
+
+type ScrapeConfig struct {
+	JobName        string              `yaml:"job_name"`
+	MetricsPath    string              `yaml:"metrics_path,omitempty"`
+	ScrapeInterval string              `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout  string              `yaml:"scrape_timeout,omitempty"`
+	Params         map[string][]string `yaml:"params,omitempty"`
+	StaticConfigs  []StaticConfig      `yaml:"static_configs,omitempty"`
+	FileSdConfigs  []any               `yaml:"file_sd_configs,omitempty"`
+	RelabelConfigs []RelabelConfig     `yaml:"relabel_configs,omitempty"`
+}
+
+type StaticConfig struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty"`
+}
+
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+}
+
+// BLACKBOX_EXPORTER is where avail export expects the blackbox exporter by
+// default.
+const BLACKBOX_EXPORTER = "127.0.0.1:9115"
+
+var promDuration = regexp.MustCompile(`^(?:([0-9]+)y)?(?:([0-9]+)w)?(?:([0-9]+)d)?(?:([0-9]+)h)?(?:([0-9]+)m)?(?:([0-9]+)s)?(?:([0-9]+)ms)?$`)
+
+// parsePromDuration parses a Prometheus duration, which unlike Go's may
+// have days, weeks and years.
+func parsePromDuration(s string) (time.Duration, bool) {
+	m := promDuration.FindStringSubmatch(s)
+	if m == nil || s == "" {
+		return 0, false
+	}
+
+	units := []time.Duration{
+		365 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour,
+		time.Hour, time.Minute, time.Second, time.Millisecond,
+	}
+	var ret time.Duration
+	for i, unit := range units {
+		n, _ := strconv.Atoi(m[i+1])
+		ret += time.Duration(n) * unit
+	}
+	return ret, true
+}
+
+// formatPromDuration formats a duration for Prometheus, which accepts
+// neither fractions nor microseconds.
+func formatPromDuration(d time.Duration) string {
+	d = max(d.Round(time.Millisecond), time.Millisecond)
+
+	var b strings.Builder
+	units := []struct {
+		unit time.Duration
+		name string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}, {time.Millisecond, "ms"}}
+	for _, u := range units {
+		if d >= u.unit {
+			fmt.Fprintf(&b, "%d%s", d/u.unit, u.name)
+			d %= u.unit
+		}
+	}
+	return b.String()
+}
+
+// importBlackbox converts the targets of the scrape configs of a Prometheus
+// config that probe through the blackbox exporter. Only http modules are
+// supported. Labels become tags, except the group label.
+func (this *Importer) importBlackbox(b []byte) error {
+	var cfg PrometheusConfig
+	err := yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		return err
+	}
+
+	interval, timeout := time.Minute, 10*time.Second
+	if cfg.Global != nil {
+		if d, ok := parsePromDuration(cfg.Global.ScrapeInterval); ok {
+			interval = d
+		}
+		if d, ok := parsePromDuration(cfg.Global.ScrapeTimeout); ok {
+			timeout = d
+		}
+	}
+
+	modules := BLACKBOX_DEFAULT_MODULES
+	if this.modules != nil {
+		modules = this.modules.Modules
+	}
+
+	for _, job := range cfg.ScrapeConfigs {
+		if job.MetricsPath != "/probe" {
+			continue
+		}
+		item := job.JobName
+		if len(job.FileSdConfigs) != 0 {
+			this.warn(item, "file_sd_configs are not supported, only static_configs are imported")
+		}
+
+		jobInterval, jobTimeout := interval, timeout
+		if d, ok := parsePromDuration(job.ScrapeInterval); ok {
+			jobInterval = d
+		}
+		if d, ok := parsePromDuration(job.ScrapeTimeout); ok {
+			jobTimeout = d
+		}
+
+		name := "http_2xx"
+		if len(job.Params["module"]) != 0 {
+			name = job.Params["module"][0]
+		}
+		module, ok := modules[name]
+		if !ok {
+			this.warn(
+				item, "skipped, module %s is unknown, pass the exporter's config with -modules",
+				name,
+			)
+			continue
+		}
+		if module.Prober != "http" {
+			this.warn(item, "skipped, the %s prober is not supported", module.Prober)
+			continue
+		}
+		if d, err := time.ParseDuration(module.Timeout); err == nil {
+			jobTimeout = min(jobTimeout, d)
+		}
+
+		site := InitSite{
+			Interval: shortDuration(jobInterval),
+			Timeout:  shortDuration(jobTimeout),
+		}
+		site.Proxy, site.Check = this.blackboxHttpCheck(item, module.Http)
+
+		targets := 0
+		for _, static := range job.StaticConfigs {
+			targets += len(static.Targets)
+		}
+		for _, static := range job.StaticConfigs {
+			for _, target := range static.Targets {
+				site := site
+				site.Url = target
+				if !strings.Contains(target, "://") {
+					site.Url = "http://" + target
+				}
+				for k, v := range static.Labels {
+					if k == "group" {
+						site.Group = v
+						continue
+					}
+					if site.Tags == nil {
+						site.Tags = make(map[string]string)
+					}
+					site.Tags[importTag(k)] = importTag(v)
+				}
+
+				if targets == 1 {
+					this.add(job.JobName, site)
+				} else {
+					this.add("", site)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// settings of http modules that make no difference to avail
+var blackboxIgnored = []string{
+	"preferred_ip_protocol", "ip_protocol_fallback", "valid_http_versions",
+}
+
+// blackboxHttpCheck converts the settings of an http module to the proxy
+// and the check of a site.
+func (this *Importer) blackboxHttpCheck(item string, http map[string]any) (string, *InitCheck) {
+	proxy := ""
+	conditions := CheckConditions{}
+	strs := func(v any) []string {
+		ret := make([]string, 0)
+		for _, s := range asAnySlice(v) {
+			ret = append(ret, fmt.Sprint(s))
+		}
+		return ret
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(http)) {
+		v := http[k]
+		switch k {
+		case "valid_status_codes":
+			statuses := StatusSet{}
+			for _, s := range strs(v) {
+				if code, ok := atoi(s); ok {
+					statuses.Add(StatusSet{Codes: []int{code}})
+				}
+			}
+			if len(statuses.Codes) != 0 {
+				conditions.Statuses = &statuses
+			}
+		case "method":
+			if strings.ToUpper(fmt.Sprint(v)) != "GET" {
+				this.warn(item, "method %v is not supported, GET is used", v)
+			}
+		case "proxy_url":
+			proxy = fmt.Sprint(v)
+		case "fail_if_body_not_matches_regexp":
+			conditions.Matches = append(conditions.Matches, strs(v)...)
+		case "fail_if_body_matches_regexp":
+			conditions.NotMatches = append(conditions.NotMatches, strs(v)...)
+		default:
+			if !slices.Contains(blackboxIgnored, k) {
+				this.warn(item, "http.%s is not supported", k)
+			}
+		}
+	}
+
+	return proxy, conditions.Check()
+}
+
+func asAnySlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// BlackboxExport is the blackbox exporter config of the sites of avail,
+// along with the Prometheus scrape configs probing them through it.
+type BlackboxExport struct {
+	Modules  BlackboxConfig
+	Scrape   PrometheusConfig
+	Warnings []string
+}
+
+var invalidPromName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ExportBlackbox converts the sites to a module each. Only checks created
+// by avail init and import, see CheckConditions, can be converted. The
+// scrape configs expect the exporter at exporter.
+func ExportBlackbox(sites []config.Ping, exporter string) (*BlackboxExport, error) {
+	ret := &BlackboxExport{
+		Modules:  BlackboxConfig{Modules: make(map[string]BlackboxModule)},
+		Scrape:   PrometheusConfig{ScrapeConfigs: make([]ScrapeConfig, 0)},
+		Warnings: make([]string, 0),
+	}
+	warn := func(title string, format string, args ...any) {
+		ret.Warnings = append(ret.Warnings, title+": "+fmt.Sprintf(format, args...))
+	}
+
+	for _, site := range sites {
+		interval, err := time.ParseDuration(string(site.Interval))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", site.Title, err)
+		}
+		timeout, err := time.ParseDuration(string(site.Timeout))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", site.Title, err)
+		}
+		if timeout > interval {
+			warn(site.Title, "timeout %s is longer than the interval, %s is used", timeout, interval)
+			timeout = interval
+		}
+
+		name := invalidPromName.ReplaceAllString(site.Title, "_")
+		for i := 2; ; i++ {
+			_, taken := ret.Modules.Modules[name]
+			if !taken {
+				break
+			}
+			name = invalidPromName.ReplaceAllString(site.Title, "_") + "_" + strconv.Itoa(i)
+		}
+
+		http := make(map[string]any)
+		if site.Proxy != nil {
+			http["proxy_url"] = string(*site.Proxy)
+		}
+		check, err := site.GetCheck()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", site.Title, err)
+		}
+		switch c := check.(type) {
+		case nil:
+		case *config.ShellCheck:
+			conditions, ok := ParseCheckConditions(c.Script)
+			if !ok || (c.Shell != "" && c.Shell != "/usr/bin/sh") {
+				warn(site.Title, "check not exported, only the checks of avail init and import are understood")
+				break
+			}
+			if conditions.Statuses != nil {
+				http["valid_status_codes"] = conditions.Statuses.Expand()
+			}
+			if len(conditions.Matches) != 0 {
+				http["fail_if_body_not_matches_regexp"] = conditions.Matches
+			}
+			if len(conditions.NotMatches) != 0 {
+				http["fail_if_body_matches_regexp"] = conditions.NotMatches
+			}
+		default:
+			warn(site.Title, "check not exported, only the checks of avail init and import are understood")
+		}
+
+		module := BlackboxModule{Prober: "http", Timeout: formatPromDuration(timeout)}
+		if len(http) != 0 {
+			module.Http = http
+		}
+		ret.Modules.Modules[name] = module
+
+		labels := make(map[string]string)
+		if site.Group != nil {
+			labels["group"] = string(*site.Group)
+		}
+		for k, v := range site.Tags {
+			labels[invalidPromName.ReplaceAllString(k, "_")] = v
+		}
+		static := StaticConfig{Targets: []string{site.Url}}
+		if len(labels) != 0 {
+			static.Labels = labels
+		}
+
+		ret.Scrape.ScrapeConfigs = append(ret.Scrape.ScrapeConfigs, ScrapeConfig{
+			JobName:        site.Title,
+			MetricsPath:    "/probe",
+			ScrapeInterval: formatPromDuration(interval),
+			ScrapeTimeout:  formatPromDuration(timeout),
+			Params:         map[string][]string{"module": {name}},
+			StaticConfigs:  []StaticConfig{static},
+			RelabelConfigs: []RelabelConfig{
+				{SourceLabels: []string{"__address__"}, TargetLabel: "__param_target"},
+				{SourceLabels: []string{"__param_target"}, TargetLabel: "instance"},
+				{TargetLabel: "__address__", Replacement: exporter},
+			},
+		})
+	}
+
+	return ret, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
@@ -12,7 +13,9 @@ import (
 	"github.com/thekhanj/avail/exec"
 )
 
-func NewCheckFromConfig(cfg config.Check) (Check, error) {
+// NewCheckFromConfig creates a check. The output of scripts is logged to
+// log, if enabled.
+func NewCheckFromConfig(cfg config.Check, log *slog.Logger) (Check, error) {
 	if cfg == nil {
 		return &StatusCheck{}, nil
 	}
@@ -23,7 +26,7 @@ func NewCheckFromConfig(cfg config.Check) (Check, error) {
 			script: c.Script,
 		}
 		if c.Log {
-			ret.log = log.New(os.Stderr, "shell-check", 0)
+			ret.log = newCheckLog(log, "shell")
 		}
 		return ret, nil
 	}
@@ -33,7 +36,7 @@ func NewCheckFromConfig(cfg config.Check) (Check, error) {
 			command: c.Exec,
 		}
 		if c.Log {
-			ret.log = log.New(os.Stderr, "exec-check", 0)
+			ret.log = newCheckLog(log, "exec")
 		}
 		return ret, nil
 	}
@@ -43,6 +46,10 @@ func NewCheckFromConfig(cfg config.Check) (Check, error) {
 	return nil, invalidErr
 }
 
+func newCheckLog(l *slog.Logger, check string) *log.Logger {
+	return slog.NewLogLogger(l.With("check", check).Handler(), slog.LevelInfo)
+}
+
 type Check interface {
 	IsUp(res *http.Response) (bool, error)
 }
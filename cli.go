@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/thekhanj/avail/common"
 	"github.com/thekhanj/avail/config"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 var VERSION = "dev"
@@ -20,8 +28,25 @@ const (
 	CODE_INVALID_CONFIG
 	CODE_INVALID_INVOKATION
 	CODE_INITIALIZATION_FAILED
+	CODE_SITES_DEGRADED
+	CODE_SITES_DOWN
+	CODE_SITES_UNKNOWN
+	CODE_TIMEOUT
 )
 
+func stateExitCode(state State) int {
+	switch state {
+	case STATE_UP:
+		return CODE_SUCCESS
+	case STATE_DEGRADED:
+		return CODE_SITES_DEGRADED
+	case STATE_DOWN:
+		return CODE_SITES_DOWN
+	default:
+		return CODE_SITES_UNKNOWN
+	}
+}
+
 type PidFlags struct {
 	cfgPath    string
 	optPid     int
@@ -38,15 +63,9 @@ func (this *PidFlags) GetPid() (int, error) {
 	if this.optPid != 0 {
 		return this.optPid, nil
 	} else {
-		var pidFile string
-		if this.optPidFile != "" {
-			pidFile = this.optPidFile
-		} else {
-			cfg, err := config.ReadConfig(this.cfgPath)
-			if err != nil {
-				return 0, err
-			}
-			pidFile = cfg.GetPidFile()
+		pidFile, err := this.GetPidFile()
+		if err != nil {
+			return 0, err
 		}
 		pid, err := common.GetPid(pidFile)
 		if err != nil {
@@ -56,6 +75,19 @@ func (this *PidFlags) GetPid() (int, error) {
 	}
 }
 
+// GetPidFile returns the PID file of the daemon, or an empty string if it
+// is unknown because the PID was given directly.
+func (this *PidFlags) GetPidFile() (string, error) {
+	if this.optPid != 0 {
+		return "", nil
+	}
+	if this.optPidFile != "" {
+		return this.optPidFile, nil
+	}
+
+	return config.ReadPidFile(this.cfgPath)
+}
+
 type Cli struct {
 	args []string
 }
@@ -71,8 +103,21 @@ func (this *Cli) Exec() int {
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Available Commands:")
 		fmt.Fprintln(os.Stderr, "  run       run the daemon")
+		fmt.Fprintln(os.Stderr, "  stop      stop the daemon")
+		fmt.Fprintln(os.Stderr, "  restart   restart the daemon in the background")
+		fmt.Fprintln(os.Stderr, "  reload    reload the daemon's config")
 		fmt.Fprintln(os.Stderr, "  status    show status of sites")
 		fmt.Fprintln(os.Stderr, "  list      list sites")
+		fmt.Fprintln(os.Stderr, "  check     check sites on demand")
+		fmt.Fprintln(os.Stderr, "  probe     check a url once, without the daemon")
+		fmt.Fprintln(os.Stderr, "  pause     pause checking sites")
+		fmt.Fprintln(os.Stderr, "  resume    resume checking paused sites")
+		fmt.Fprintln(os.Stderr, "  wait      wait until sites reach a state")
+		fmt.Fprintln(os.Stderr, "  top       live view of sites")
+		fmt.Fprintln(os.Stderr, "  init      create a config file for some urls")
+		fmt.Fprintln(os.Stderr, "  validate  check the config file for mistakes")
+		fmt.Fprintln(os.Stderr, "  import    convert the config of another monitoring tool")
+		fmt.Fprintln(os.Stderr, "  export    convert the config to a blackbox exporter config")
 		fmt.Fprintln(os.Stderr, "  schema    show http address of config's json schema")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
@@ -101,12 +146,38 @@ func (this *Cli) Exec() int {
 	switch cmd {
 	case "run":
 		return this.run(f.Args()[1:])
+	case "stop":
+		return this.stop(f.Args()[1:])
+	case "restart":
+		return this.restart(f.Args()[1:])
+	case "reload":
+		return this.reload(f.Args()[1:])
 	case "status":
 		return this.status(f.Args()[1:])
 	case "list":
 		return this.list(f.Args()[1:])
+	case "check":
+		return this.check(f.Args()[1:])
+	case "probe":
+		return this.probe(f.Args()[1:])
+	case "pause":
+		return this.pause(f.Args()[1:])
+	case "resume":
+		return this.resume(f.Args()[1:])
+	case "wait":
+		return this.wait(f.Args()[1:])
+	case "top":
+		return this.top(f.Args()[1:])
 	case "http":
 		return this.http(f.Args()[1:])
+	case "init":
+		return this.init(f.Args()[1:])
+	case "validate":
+		return this.validate(f.Args()[1:])
+	case "import":
+		return this.importConfig(f.Args()[1:])
+	case "export":
+		return this.exportConfig(f.Args()[1:])
 	case "schema":
 		return this.schema(f.Args()[1:])
 	default:
@@ -119,10 +190,18 @@ func (this *Cli) run(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
 	cfgPath := f.String("c", common.GetDefaultCfg(), "config file")
+	detach := f.Bool("d", false, "run in the background")
+	logFile := f.String("log", common.GetDefaultLogFile(), "log file, used with -d")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
 		fmt.Fprintln(os.Stderr, "  avail run")
+		fmt.Fprintln(os.Stderr, "  avail run -d [-log file]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  runs the daemon in the foreground, or with -d detached in the background,")
+		fmt.Fprintln(os.Stderr, "  for systems without a service manager. -d prints the daemon's PID once")
+		fmt.Fprintln(os.Stderr, "  it started.")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -146,8 +225,38 @@ func (this *Cli) run(args []string) int {
 		return CODE_INVALID_CONFIG
 	}
 
+	if *detach {
+		return this.daemonize(*cfgPath, cfg.GetPidFile(), *logFile)
+	}
+
+	logger, err := NewLogger(os.Stderr, cfg.GetLog())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_CONFIG
+	}
+	slog.SetDefault(logger)
+
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INITIALIZATION_FAILED
+	}
+	if notifier != nil {
+		defer notifier.Close()
+	}
+	listenFiles, err := ListenFilesFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INITIALIZATION_FAILED
+	}
+
 	ctx := common.NewSignalCtx(context.Background())
-	d := NewDaemon(cfg)
+	d := NewDaemon(
+		cfg,
+		DaemonWithConfigPath(*cfgPath),
+		DaemonWithNotifier(notifier),
+		DaemonWithListenFiles(listenFiles),
+	)
 
 	err = d.Run(ctx)
 	if err != nil {
@@ -158,16 +267,31 @@ func (this *Cli) run(args []string) int {
 	return CODE_SUCCESS
 }
 
-func (this *Cli) status(args []string) int {
+func (this *Cli) daemonize(cfgPath, pidFile, logFile string) int {
+	pid, err := Daemonize(cfgPath, pidFile, logFile, 10*time.Second)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INITIALIZATION_FAILED
+	}
+
+	fmt.Println(pid)
+	return CODE_SUCCESS
+}
+
+func (this *Cli) stop(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
 	pf := PidFlags{}
 	pf.SetFlags(f)
+	timeout := f.Duration("timeout", 10*time.Second, "time to wait for the daemon to exit")
+	kill := f.Bool("kill", false, "kill the daemon if it does not exit in time")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail status")
-		fmt.Fprintln(os.Stderr, "  avail status <title...>")
+		fmt.Fprintln(os.Stderr, "  avail stop")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  sends SIGTERM to the running daemon and waits for it to exit.")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -181,44 +305,63 @@ func (this *Cli) status(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	var err error
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
 
-	pid, err := pf.GetPid()
+	return this.stopDaemon(&pf, *timeout, *kill, false)
+}
+
+// stopDaemon stops the running daemon. With ignoreMissing set, it is not
+// an error if the daemon is not running.
+func (this *Cli) stopDaemon(pf *PidFlags, timeout time.Duration, kill bool, ignoreMissing bool) int {
+	pidFile, err := pf.GetPidFile()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return CODE_GENERAL_ERR
+		return CODE_INVALID_CONFIG
 	}
 
-	info := NewInfo(pid)
-
-	titles := f.Args()
-	if len(titles) == 0 {
-		titles, err = info.Titles()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			return CODE_GENERAL_ERR
+	pid, err := pf.GetPid()
+	if err == nil && !common.ProcessExists(pid) {
+		err = fmt.Errorf("no process with PID %d", pid)
+	}
+	if err != nil {
+		if ignoreMissing {
+			return CODE_SUCCESS
 		}
+		fmt.Fprintf(os.Stderr, "error: daemon is not running: %v\n", err)
+		return CODE_GENERAL_ERR
 	}
 
-	statuses, err := info.SitesStatus(titles)
+	err = Stop(pid, pidFile, timeout, kill)
+	if errors.Is(err, ErrStopTimeout) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_TIMEOUT
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return CODE_GENERAL_ERR
 	}
 
-	fmt.Println(statuses)
 	return CODE_SUCCESS
 }
 
-func (this *Cli) list(args []string) int {
+func (this *Cli) restart(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
 	pf := PidFlags{}
 	pf.SetFlags(f)
+	timeout := f.Duration("timeout", 10*time.Second, "time to wait for the daemon to exit")
+	kill := f.Bool("kill", false, "kill the daemon if it does not exit in time")
+	logFile := f.String("log", common.GetDefaultLogFile(), "log file of the new daemon")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail list")
+		fmt.Fprintln(os.Stderr, "  avail restart")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  stops the running daemon, if any, and starts a new one in the background")
+		fmt.Fprintln(os.Stderr, "  with the given config, like \"avail run -d\".")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -232,26 +375,26 @@ func (this *Cli) list(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	var err error
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
 
-	pid, err := pf.GetPid()
+	// don't stop a working daemon for a broken config
+	cfg, err := config.ReadConfig(pf.cfgPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return CODE_GENERAL_ERR
+		return CODE_INVALID_CONFIG
 	}
 
-	info := NewInfo(pid)
-	titles, err := info.Titles()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return CODE_GENERAL_ERR
+	code := this.stopDaemon(&pf, *timeout, *kill, true)
+	if code != CODE_SUCCESS {
+		return code
 	}
 
-	fmt.Println(strings.Join(titles, "\n"))
-	return CODE_SUCCESS
+	return this.daemonize(pf.cfgPath, cfg.GetPidFile(), *logFile)
 }
 
-func (this *Cli) http(args []string) int {
+func (this *Cli) reload(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
 	pf := PidFlags{}
@@ -259,21 +402,12 @@ func (this *Cli) http(args []string) int {
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail http <command> [arguments]")
-		fmt.Fprintln(os.Stderr)
-
-		fmt.Fprintln(os.Stderr, "Available Commands:")
-		fmt.Fprintln(os.Stderr, "  status    get http status line")
-		fmt.Fprintln(os.Stderr, "  header    get a header value")
-		fmt.Fprintln(os.Stderr, "  body      get response body")
+		fmt.Fprintln(os.Stderr, "  avail reload")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Description:")
-		fmt.Fprintln(os.Stderr, "  reads a raw http response from the file set in AVAIL_HTTP and extracts parts of it")
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, "Examples:")
-		fmt.Fprintln(os.Stderr, "  avail http status")
-		fmt.Fprintln(os.Stderr, "  avail http header content-type")
-		fmt.Fprintln(os.Stderr, "  avail http body")
+		fmt.Fprintln(os.Stderr, "  makes the running daemon re-read its config file, same as sending SIGHUP.")
+		fmt.Fprintln(os.Stderr, "  invalid configs are rejected and the current one keeps running, the")
+		fmt.Fprintln(os.Stderr, "  error is reported unless the daemon's control socket is unavailable.")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -287,37 +421,58 @@ func (this *Cli) http(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	if len(f.Args()) == 0 {
-		return this.notEnoughArguments()
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
 	}
 
-	cmd := f.Args()[0]
-	switch cmd {
-	case "status":
-		return this.httpStatus(f.Args()[1:])
-	case "header":
-		return this.httpHeader(f.Args()[1:])
-	case "body":
-		return this.httpBody(f.Args()[1:])
-	default:
-		fmt.Fprintf(os.Stderr, "error: invalid command \"%s\"\n", cmd)
-		return CODE_INVALID_INVOKATION
+	pid, err := pf.GetPid()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	err = Connect(pid).Reload()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
 	}
+
+	return CODE_SUCCESS
 }
 
-func (this *Cli) httpStatus(args []string) int {
+func (this *Cli) status(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	of := OutputFlags{}
+	of.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
+	check := f.Bool("check", false, "exit with a non-zero code if any site is not up")
+	grouped := f.Bool("grouped", false, "show the sites in sections by group, with the state of each group")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail http status")
+		fmt.Fprintln(os.Stderr, "  avail status")
+		fmt.Fprintln(os.Stderr, "  avail status <title...>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Exit Codes (with -check):")
+		fmt.Fprintf(os.Stderr, "  %d    all sites are up\n", CODE_SUCCESS)
+		fmt.Fprintf(os.Stderr, "  %d    some sites are down\n", CODE_SITES_DEGRADED)
+		fmt.Fprintf(os.Stderr, "  %d    all sites are down\n", CODE_SITES_DOWN)
+		fmt.Fprintf(os.Stderr, "  %d    no site is down, but some are not checked yet\n", CODE_SITES_UNKNOWN)
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail status -format json | jq '.[] | select(.health | not)'")
+		fmt.Fprintln(os.Stderr, "  avail status -template '{{.Title}} {{.Latency}}'")
+		fmt.Fprintln(os.Stderr, "  avail status -l env=prod -grouped")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
 	}
 
-	f.Parse(args)
+	titles := parseInterspersed(f, args)
 
 	if *help {
 		f.Usage()
@@ -325,28 +480,66 @@ func (this *Cli) httpStatus(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	if len(f.Args()) != 0 {
-		return this.extraArgument(f.Arg(0))
+	var err error
+
+	err = of.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
 	}
 
-	http, err := OpenHttpResponse()
+	statuses, err := this.readSelected(&pf, &sf, titles)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return CODE_GENERAL_ERR
 	}
-	defer http.Close()
 
-	fmt.Println(http.Response.StatusCode)
+	if *grouped {
+		groups := GroupStatuses(statuses)
+		if of.IsText() {
+			for i, g := range groups {
+				if i != 0 {
+					fmt.Println()
+				}
+				fmt.Println(g)
+			}
+		} else {
+			err = Write(os.Stdout, &of, SiteStatusGroupHeader, groups)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return CODE_GENERAL_ERR
+			}
+		}
+	} else if of.IsText() {
+		fmt.Println(statuses)
+	} else {
+		err = Write(os.Stdout, &of, SiteStatusHeader, statuses)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	if *check {
+		return stateExitCode(statuses.State())
+	}
+
 	return CODE_SUCCESS
 }
 
-func (this *Cli) httpHeader(args []string) int {
+func (this *Cli) list(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	of := OutputFlags{}
+	of.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail schema")
+		fmt.Fprintln(os.Stderr, "  avail list")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -360,32 +553,67 @@ func (this *Cli) httpHeader(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	if len(f.Args()) == 0 {
-		return this.notEnoughArguments()
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
 	}
-	if len(f.Args()) != 1 {
-		return this.extraArgument(f.Arg(1))
+
+	var err error
+
+	err = of.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
 	}
 
-	http, err := OpenHttpResponse()
+	pid, err := pf.GetPid()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	client := Connect(pid)
+	titles, err := client.Titles()
+	if err == nil {
+		titles, err = sf.Select(client, titles)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	if of.IsText() {
+		fmt.Println(strings.Join(titles, "\n"))
+		return CODE_SUCCESS
+	}
+
+	entries := make([]SiteEntry, len(titles))
+	for i, title := range titles {
+		entries[i], err = client.SiteEntry(title)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	err = Write(os.Stdout, &of, SiteEntryHeader, entries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return CODE_GENERAL_ERR
 	}
-	defer http.Close()
 
-	key := f.Arg(0)
-	fmt.Println(http.Response.Header.Get(key))
 	return CODE_SUCCESS
 }
 
-func (this *Cli) httpBody(args []string) int {
+func (this *Cli) check(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail body")
+		fmt.Fprintln(os.Stderr, "  avail check <command> [arguments]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Available Commands:")
+		fmt.Fprintln(os.Stderr, "  now       check a site right away and show the result")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
@@ -399,39 +627,47 @@ func (this *Cli) httpBody(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	if len(f.Args()) != 0 {
-		return this.extraArgument(f.Arg(0))
-	}
-
-	http, err := OpenHttpResponse()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		return CODE_GENERAL_ERR
+	if len(f.Args()) == 0 {
+		return this.notEnoughArguments()
 	}
-	defer http.Close()
 
-	_, err = io.Copy(os.Stdout, http.Response.Body)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v", err)
-		return CODE_GENERAL_ERR
+	cmd := f.Args()[0]
+	switch cmd {
+	case "now":
+		return this.checkNow(f.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid command \"%s\"\n", cmd)
+		return CODE_INVALID_INVOKATION
 	}
-
-	return CODE_SUCCESS
 }
 
-func (this *Cli) schema(args []string) int {
+func (this *Cli) checkNow(args []string) int {
 	f := flag.NewFlagSet("avail", flag.ExitOnError)
 	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	of := OutputFlags{}
+	of.SetFlags(f)
+	timeout := f.Duration("timeout", time.Minute, "give up after this duration")
 
 	f.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  avail schema")
+		fmt.Fprintln(os.Stderr, "  avail check now <title>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  asks the running daemon to check a site right away, regardless of its")
+		fmt.Fprintln(os.Stderr, "  interval, and waits for the result. the regular schedule is not affected.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Exit Codes:")
+		fmt.Fprintf(os.Stderr, "  %d    the site is up\n", CODE_SUCCESS)
+		fmt.Fprintf(os.Stderr, "  %d    the site is down\n", CODE_SITES_DOWN)
+		fmt.Fprintf(os.Stderr, "  %d    timed out waiting for the result\n", CODE_TIMEOUT)
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Flags:")
 		f.PrintDefaults()
 	}
 
-	f.Parse(args)
+	titles := parseInterspersed(f, args)
 
 	if *help {
 		f.Usage()
@@ -439,28 +675,1072 @@ func (this *Cli) schema(args []string) int {
 		return CODE_SUCCESS
 	}
 
-	if len(f.Args()) != 0 {
-		return this.extraArgument(f.Arg(0))
+	if len(titles) == 0 {
+		return this.notEnoughArguments()
+	}
+	if len(titles) != 1 {
+		return this.extraArgument(titles[1])
 	}
 
-	fmt.Println(common.GetJsonSchemaAddress(VERSION))
-	return CODE_SUCCESS
-}
-
-func (this *Cli) notEnoughArguments() int {
-	fmt.Fprintln(os.Stderr, "error: not enough arguments.")
-	fmt.Fprintln(os.Stderr, "Try '-h' for help.")
+	var err error
 
-	return CODE_INVALID_INVOKATION
-}
+	err = of.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
+	}
 
-func (this *Cli) extraArgument(arg string) int {
-	fmt.Fprintf(os.Stderr, "error: extra argument: %v\n", arg)
+	pid, err := pf.GetPid()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	ctx, cancel := context.WithTimeout(
+		common.NewSignalCtx(context.Background()), *timeout,
+	)
+	defer cancel()
+
+	status, err := Connect(pid).CheckNow(ctx, titles[0])
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintln(os.Stderr, "error: timed out waiting for the check")
+		return CODE_TIMEOUT
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	if of.IsText() {
+		fmt.Println(status)
+		if status.Error != "" {
+			fmt.Printf("error: %s\n", status.Error)
+		}
+	} else {
+		err = Write(os.Stdout, &of, SiteStatusHeader, SiteStatusList{&status})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	// paused sites are checked too, so go by the health
+	if !status.Health {
+		return CODE_SITES_DOWN
+	}
+	return CODE_SUCCESS
+}
+
+func (this *Cli) probe(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	cfgPath := f.String("c", common.GetDefaultCfg(), "config file, used with -title")
+	title := f.String("title", "", "probe the site with this title from the config instead of a url")
+	timeout := f.String("timeout", "30s", "request timeout")
+	proxy := f.String("proxy", "", "proxy to send the request through")
+	of := OutputFlags{}
+	of.SetFlags(f)
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail probe <url>")
+		fmt.Fprintln(os.Stderr, "  avail probe -title <title>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  runs a single check the same way the daemon does, without a running")
+		fmt.Fprintln(os.Stderr, "  daemon, and shows the timing of each phase of the request.")
+		fmt.Fprintln(os.Stderr, "  with -title, the site's proxy, timeout and check from the config are")
+		fmt.Fprintln(os.Stderr, "  used, which is handy for debugging check scripts.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Exit Codes:")
+		fmt.Fprintf(os.Stderr, "  %d    the check passed\n", CODE_SUCCESS)
+		fmt.Fprintf(os.Stderr, "  %d    the check failed\n", CODE_SITES_DOWN)
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	positional := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	var err error
+
+	err = of.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
+	}
+
+	var pingCfg *config.Ping
+	if *title != "" {
+		if len(positional) != 0 {
+			return this.extraArgument(positional[0])
+		}
+
+		cfg, err := config.ReadConfig(*cfgPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_INVALID_CONFIG
+		}
+		for i := range cfg.Sites {
+			if cfg.Sites[i].Title == *title {
+				pingCfg = &cfg.Sites[i]
+				break
+			}
+		}
+		if pingCfg == nil {
+			fmt.Fprintf(os.Stderr, "error: site not found: %s\n", *title)
+			return CODE_GENERAL_ERR
+		}
+	} else {
+		if len(positional) == 0 {
+			return this.notEnoughArguments()
+		}
+		if len(positional) != 1 {
+			return this.extraArgument(positional[1])
+		}
+
+		pingCfg = &config.Ping{
+			Title:    "probe",
+			Url:      positional[0],
+			Interval: "5s",
+			Timeout:  config.Duration(*timeout),
+		}
+		if *proxy != "" {
+			p := config.Proxy(*proxy)
+			pingCfg.Proxy = &p
+		}
+	}
+
+	ping, err := NewPingFromConfig(pingCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
+	}
+
+	ctx := common.NewSignalCtx(context.Background())
+	res := ping.Probe(ctx)
+
+	if of.IsText() {
+		fmt.Println(res)
+	} else {
+		err = Write(os.Stdout, &of, ProbeResultHeader, []ProbeResult{res})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	if !res.Health {
+		return CODE_SITES_DOWN
+	}
+	return CODE_SUCCESS
+}
+
+func (this *Cli) pause(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
+	duration := f.Duration("for", 0, "resume automatically after this duration, 0 pauses until resumed")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail pause <title...>")
+		fmt.Fprintln(os.Stderr, "  avail pause -l <selector> | -group <group>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  stops the scheduled checks of sites without removing them from the config.")
+		fmt.Fprintln(os.Stderr, "  paused sites keep their state and are shown as PAUSED by status.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail pause api --for 30m")
+		fmt.Fprintln(os.Stderr, "  avail pause --group edge --for 1h")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	titles := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if *duration < 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid duration \"%s\"\n", duration)
+		return CODE_INVALID_INVOKATION
+	}
+
+	request := REQUEST_PAUSE
+	if *duration != 0 {
+		request += " " + duration.String()
+	}
+
+	return this.sendRequests(&pf, &sf, titles, request)
+}
+
+func (this *Cli) resume(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail resume <title...>")
+		fmt.Fprintln(os.Stderr, "  avail resume -l <selector> | -group <group>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	titles := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	return this.sendRequests(&pf, &sf, titles, REQUEST_RESUME)
+}
+
+// sendRequests sends a request to each of the given sites of the running
+// daemon.
+func (this *Cli) sendRequests(
+	pf *PidFlags, sf *SelectorFlags, titles []string, request string,
+) int {
+	selector, err := sf.Selector()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
+	}
+	if len(titles) == 0 && selector.Empty() {
+		return this.notEnoughArguments()
+	}
+
+	pid, err := pf.GetPid()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	client := Connect(pid)
+	titles, err = sf.Select(client, titles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	// fail early instead of leaving some sites paused
+	for _, title := range titles {
+		_, err = client.SiteEntry(title)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	for _, title := range titles {
+		err = client.Request(title, request)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", title, err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	return CODE_SUCCESS
+}
+
+func (this *Cli) wait(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
+	until := f.String("until", "up", "state to wait for (up, down)")
+	timeout := f.Duration("timeout", 0, "give up after this duration, 0 waits forever")
+	interval := f.Duration("interval", time.Second, "polling interval")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail wait [title...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  blocks until all given sites (or all sites if none given) reach the")
+		fmt.Fprintln(os.Stderr, "  desired state, as reported by the running daemon. fails right away if")
+		fmt.Fprintln(os.Stderr, "  the daemon is not running or a site is not found")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail wait api web --until up --timeout 5m")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	titles := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	var desired State
+	switch *until {
+	case "up":
+		desired = STATE_UP
+	case "down":
+		desired = STATE_DOWN
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid state \"%s\"\n", *until)
+		return CODE_INVALID_INVOKATION
+	}
+
+	ctx := common.NewSignalCtx(context.Background())
+	if *timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	for {
+		// a missing site or daemon would never reach the state
+		statuses, err := this.readSelected(&pf, &sf, titles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+		if statuses.State() == desired {
+			fmt.Println(statuses)
+			return CODE_SUCCESS
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println(statuses)
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Fprintf(os.Stderr, "error: timed out waiting for sites to be %s\n", desired)
+				return CODE_TIMEOUT
+			}
+			return CODE_GENERAL_ERR
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func (this *Cli) top(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+	sf := SelectorFlags{}
+	sf.SetFlags(f)
+	refresh := f.Duration("refresh", time.Second, "refresh interval")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail top")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Keys:")
+		fmt.Fprintln(os.Stderr, "  q          quit")
+		fmt.Fprintln(os.Stderr, "  j/k        move selection")
+		fmt.Fprintln(os.Stderr, "  r          re-check the selected site now")
+		fmt.Fprintln(os.Stderr, "  p          pause/resume the selected site")
+		fmt.Fprintln(os.Stderr, "  s          change sort order")
+		fmt.Fprintln(os.Stderr, "  f          filter by state")
+		fmt.Fprintln(os.Stderr, "  /          search by title")
+		fmt.Fprintln(os.Stderr, "  l          select by tags, e.g. env=prod,!canary")
+		fmt.Fprintln(os.Stderr, "  esc        clear the search and tag selector")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	pid, err := pf.GetPid()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	selector, err := sf.Selector()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_INVOKATION
+	}
+
+	ctx := common.NewSignalCtx(context.Background())
+	err = NewTop(
+		pid, TopWithRefresh(*refresh), TopWithSelector(selector),
+	).Run(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	return CODE_SUCCESS
+}
+
+// readStatuses reads the status of the given sites, or all sites if titles
+// is empty, from the running daemon.
+func (this *Cli) readStatuses(pf *PidFlags, titles []string) (SiteStatusList, error) {
+	pid, err := pf.GetPid()
+	if err != nil {
+		return nil, err
+	}
+
+	return Connect(pid).SitesStatus(titles)
+}
+
+// readSelected reads the status of the given sites, or all sites if titles
+// is empty, narrowed down by the selector.
+func (this *Cli) readSelected(
+	pf *PidFlags, sf *SelectorFlags, titles []string,
+) (SiteStatusList, error) {
+	selector, err := sf.Selector()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := this.readStatuses(pf, titles)
+	if err != nil || selector.Empty() {
+		return statuses, err
+	}
+
+	statuses = selector.Filter(statuses)
+	if len(statuses) == 0 {
+		return nil, ErrNoSiteSelected
+	}
+	statuses.Apply(SiteStatusWithTitleLength(statuses.MaxTitleLength()))
+	return statuses, nil
+}
+
+func (this *Cli) http(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	pf := PidFlags{}
+	pf.SetFlags(f)
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail http <command> [arguments]")
+		fmt.Fprintln(os.Stderr)
+
+		fmt.Fprintln(os.Stderr, "Available Commands:")
+		fmt.Fprintln(os.Stderr, "  status    get http status line")
+		fmt.Fprintln(os.Stderr, "  header    get a header value")
+		fmt.Fprintln(os.Stderr, "  body      get response body")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  reads a raw http response from the file set in AVAIL_HTTP and extracts parts of it")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail http status")
+		fmt.Fprintln(os.Stderr, "  avail http header content-type")
+		fmt.Fprintln(os.Stderr, "  avail http body")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) == 0 {
+		return this.notEnoughArguments()
+	}
+
+	cmd := f.Args()[0]
+	switch cmd {
+	case "status":
+		return this.httpStatus(f.Args()[1:])
+	case "header":
+		return this.httpHeader(f.Args()[1:])
+	case "body":
+		return this.httpBody(f.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid command \"%s\"\n", cmd)
+		return CODE_INVALID_INVOKATION
+	}
+}
+
+func (this *Cli) httpStatus(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail http status")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	http, err := OpenHttpResponse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return CODE_GENERAL_ERR
+	}
+	defer http.Close()
+
+	fmt.Println(http.Response.StatusCode)
+	return CODE_SUCCESS
+}
+
+func (this *Cli) httpHeader(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail schema")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) == 0 {
+		return this.notEnoughArguments()
+	}
+	if len(f.Args()) != 1 {
+		return this.extraArgument(f.Arg(1))
+	}
+
+	http, err := OpenHttpResponse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return CODE_GENERAL_ERR
+	}
+	defer http.Close()
+
+	key := f.Arg(0)
+	fmt.Println(http.Response.Header.Get(key))
+	return CODE_SUCCESS
+}
+
+func (this *Cli) httpBody(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail body")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	http, err := OpenHttpResponse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return CODE_GENERAL_ERR
+	}
+	defer http.Close()
+
+	_, err = io.Copy(os.Stdout, http.Response.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v", err)
+		return CODE_GENERAL_ERR
+	}
+
+	return CODE_SUCCESS
+}
+
+func (this *Cli) init(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	cfgPath := f.String("c", common.GetDefaultCfg(), "config file to write, its extension selects the format")
+	from := f.String("from", "", "read urls from a file, e.g. exported bookmarks")
+	force := f.Bool("f", false, "replace an existing config file")
+	timeout := f.Duration("timeout", 10*time.Second, "timeout of probing each url")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail init [url...]")
+		fmt.Fprintln(os.Stderr, "  avail init -from bookmarks.html")
+		fmt.Fprintln(os.Stderr, "  command | avail init")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  probes each url once and writes a config monitoring them, with intervals,")
+		fmt.Fprintln(os.Stderr, "  timeouts and checks suggested by the responses. without urls, they are")
+		fmt.Fprintln(os.Stderr, "  read from stdin, or asked for along with the titles on a terminal.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	urls := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	var in *bufio.Reader
+	if *from != "" {
+		if len(urls) != 0 {
+			return this.extraArgument(urls[0])
+		}
+
+		file, err := os.Open(*from)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+		urls, err = ReadInitUrls(file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	} else if len(urls) == 0 {
+		var err error
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			in = bufio.NewReader(os.Stdin)
+			fmt.Fprintln(os.Stderr, "urls to monitor, one per line, an empty line to finish:")
+			urls, err = ReadInitUrls(strings.NewReader(promptLines(in, "> ")))
+		} else {
+			urls, err = ReadInitUrls(os.Stdin)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no urls")
+		return CODE_INVALID_INVOKATION
+	}
+
+	ctx := common.NewSignalCtx(context.Background())
+	client := &http.Client{Timeout: *timeout}
+	sites := SuggestSites(ctx, client, urls, func(site InitSite) {
+		fmt.Fprintf(os.Stderr, "probed %s\n", site.Url)
+		for _, note := range site.Notes {
+			fmt.Fprintf(os.Stderr, "  %s\n", note)
+		}
+	})
+
+	titles := make([]string, 0)
+	for i := range sites {
+		title := SuggestTitle(sites[i].Url, titles)
+		for in != nil {
+			fmt.Fprintf(os.Stderr, "title of %s [%s]: ", sites[i].Url, title)
+			line, _ := in.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if slices.Contains(titles, line) {
+				fmt.Fprintf(os.Stderr, "title \"%s\" is taken\n", line)
+				continue
+			}
+			if line != "" {
+				title = line
+			}
+			break
+		}
+		sites[i].Title = title
+		titles = append(titles, title)
+	}
+
+	err := NewInitConfig(sites).Write(*cfgPath, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote %s, start monitoring with: avail run -c %s\n", *cfgPath, *cfgPath)
+	return CODE_SUCCESS
+}
+
+func (this *Cli) validate(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	cfgPath := f.String("c", common.GetDefaultCfg(), "config file")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail validate [-c file]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  checks the config file and the files it includes against the schema and")
+		fmt.Fprintln(os.Stderr, "  for mistakes such as duplicate titles, a timeout longer than the interval")
+		fmt.Fprintln(os.Stderr, "  or exec checks of missing binaries. Each problem is printed as")
+		fmt.Fprintln(os.Stderr, "  file:line:column: message.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	schema, err := config.CompileSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+	problems, err := config.Validate(*cfgPath, schema)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) != 0 {
+		return CODE_INVALID_CONFIG
+	}
+
+	return CODE_SUCCESS
+}
+
+func (this *Cli) importConfig(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	from := f.String(
+		"from", "", "tool the file is of, one of "+strings.Join(IMPORT_SOURCES, ", "),
+	)
+	modules := f.String("modules", "", "config of the blackbox exporter, to resolve its modules")
+	output := f.String("o", "", "config file to write, its extension selects the format (default stdout)")
+	force := f.Bool("f", false, "replace an existing config file")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail import -from <tool> <file>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  converts the targets of another monitoring tool to sites, with the checks")
+		fmt.Fprintln(os.Stderr, "  closest to its probes. anything that cannot be converted is reported.")
+		fmt.Fprintln(os.Stderr, "  the file is, by tool:")
+		fmt.Fprintln(os.Stderr, "    blackbox     the Prometheus config probing through the exporter")
+		fmt.Fprintln(os.Stderr, "    uptime-kuma  a backup, exported in the settings")
+		fmt.Fprintln(os.Stderr, "    gatus        the config")
+		fmt.Fprintln(os.Stderr, "    nagios       object definitions of services, hosts and commands")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail import -from gatus config.yaml -o avail.yaml")
+		fmt.Fprintln(os.Stderr, "  avail import -from blackbox prometheus.yml -modules blackbox.yml")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	positional := parseInterspersed(f, args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if *from == "" || len(positional) == 0 {
+		return this.notEnoughArguments()
+	}
+	if len(positional) > 1 {
+		return this.extraArgument(positional[1])
+	}
+	if *modules != "" && *from != "blackbox" {
+		fmt.Fprintln(os.Stderr, "error: -modules is only used with -from blackbox")
+		return CODE_INVALID_INVOKATION
+	}
+
+	opts := make([]ImportOption, 0)
+	if *modules != "" {
+		b, err := os.ReadFile(*modules)
+		if err == nil {
+			var cfg *BlackboxConfig
+			cfg, err = ReadBlackboxConfig(b)
+			opts = append(opts, ImportWithModules(cfg))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", *modules, err)
+			return CODE_GENERAL_ERR
+		}
+	}
+
+	b, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+	sites, warnings, err := Import(*from, b, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", positional[0], err)
+		return CODE_GENERAL_ERR
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if len(sites) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no site to import")
+		return CODE_GENERAL_ERR
+	}
+
+	cfg := NewInitConfig(sites)
+	if *output == "" {
+		b, err := cfg.Marshal("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+		os.Stdout.Write(b)
+		return CODE_SUCCESS
+	}
+
+	err = cfg.Write(*output, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+	fmt.Fprintf(os.Stderr, "imported %d sites to %s\n", len(sites), *output)
+	return CODE_SUCCESS
+}
+
+func (this *Cli) exportConfig(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	cfgPath := f.String("c", common.GetDefaultCfg(), "config file")
+	scrape := f.Bool("scrape", false, "write the Prometheus scrape configs probing the sites instead")
+	exporter := f.String("exporter", BLACKBOX_EXPORTER, "address of the blackbox exporter, used with -scrape")
+	output := f.String("o", "", "file to write (default stdout)")
+	force := f.Bool("f", false, "replace an existing file")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail export [-scrape]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  converts the sites to a Prometheus blackbox exporter config, with a module")
+		fmt.Fprintln(os.Stderr, "  per site. with -scrape, the scrape configs probing each site through the")
+		fmt.Fprintln(os.Stderr, "  exporter are written instead. only the checks created by avail init and")
+		fmt.Fprintln(os.Stderr, "  import are converted, the others are reported.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  avail export -o blackbox.yml")
+		fmt.Fprintln(os.Stderr, "  avail export -scrape -exporter blackbox:9115 >> prometheus.yml")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	cfg, err := config.ReadConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_INVALID_CONFIG
+	}
+	if len(cfg.Discovery) != 0 {
+		fmt.Fprintln(os.Stderr, "warning: discovered sites are not exported")
+	}
+
+	export, err := ExportBlackbox(cfg.Sites, *exporter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+	for _, w := range export.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	var b []byte
+	if *scrape {
+		b, err = yaml.Marshal(export.Scrape)
+	} else {
+		b, err = yaml.Marshal(export.Modules)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+
+	if *output == "" {
+		os.Stdout.Write(b)
+		return CODE_SUCCESS
+	}
+	err = writeNewFile(*output, b, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return CODE_GENERAL_ERR
+	}
+	return CODE_SUCCESS
+}
+
+func (this *Cli) schema(args []string) int {
+	f := flag.NewFlagSet("avail", flag.ExitOnError)
+	help := f.Bool("h", false, "show help")
+	printSchema := f.Bool("print", false, "print the schema embedded in the binary")
+	writePath := f.String("write", "", "write the schema embedded in the binary to a file")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  avail schema")
+		fmt.Fprintln(os.Stderr, "  avail schema --print")
+		fmt.Fprintln(os.Stderr, "  avail schema --write <path>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Description:")
+		fmt.Fprintln(os.Stderr, "  shows the http address of the config's json schema for this version,")
+		fmt.Fprintln(os.Stderr, "  or the schema itself, which configs are validated against, for hosts")
+		fmt.Fprintln(os.Stderr, "  and editors without network access.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 0 {
+		return this.extraArgument(f.Arg(0))
+	}
+
+	switch {
+	case *printSchema && *writePath != "":
+		fmt.Fprintln(os.Stderr, "error: --print and --write are exclusive")
+		return CODE_INVALID_INVOKATION
+	case *printSchema:
+		os.Stdout.Write(schemaJson)
+	case *writePath != "":
+		err := os.WriteFile(*writePath, schemaJson, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return CODE_GENERAL_ERR
+		}
+	default:
+		fmt.Println(common.GetJsonSchemaAddress(VERSION))
+	}
+
+	return CODE_SUCCESS
+}
+
+func (this *Cli) notEnoughArguments() int {
+	fmt.Fprintln(os.Stderr, "error: not enough arguments.")
 	fmt.Fprintln(os.Stderr, "Try '-h' for help.")
 
 	return CODE_INVALID_INVOKATION
 }
 
+func (this *Cli) extraArgument(arg string) int {
+	fmt.Fprintf(os.Stderr, "error: extra argument: %v\n", arg)
+	fmt.Fprintln(os.Stderr, "Try '-h' for help.")
+
+	return CODE_INVALID_INVOKATION
+}
+
+// parseInterspersed parses flags that may appear after positional
+// arguments (e.g. "avail wait api --timeout 5m") and returns the positional
+// arguments.
+func parseInterspersed(f *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+
+	for {
+		f.Parse(args)
+		rest := f.Args()
+
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	return positional
+}
+
 func main() {
 	c := Cli{args: os.Args[1:]}
 	os.Exit(c.Exec())
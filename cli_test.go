@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStatusInterspersed(t *testing.T) {
+	c := Cli{}
+
+	// parsed as a title, the flag would make the command fail to read it
+	code := c.status([]string{"web", "-format", "invalid"})
+	if code != CODE_INVALID_INVOKATION {
+		t.Fatalf("expected flags after titles to be parsed, got code %d", code)
+		return
+	}
+}
+
+func TestWaitSiteNotFound(t *testing.T) {
+	c := Cli{}
+
+	code := c.wait([]string{
+		"-P", strconv.Itoa(os.Getpid()), "-timeout", "5s", "avail-test-missing",
+	})
+	if code != CODE_GENERAL_ERR {
+		t.Fatalf("expected a missing site to fail right away, got code %d", code)
+		return
+	}
+}
+
+func TestStatusUnsetVariable(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "avail.pid")
+	cfgPath := filepath.Join(dir, "avail.json")
+	err := os.WriteFile(cfgPath, []byte(`{
+  "pidFile": `+strconv.Quote(pidFile)+`,
+  "sites": [{"title": "a", "url": "https://example.com/?token=${AVAIL_TEST_UNSET}"}]
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	c := Cli{}
+	code := c.status([]string{"-c", cfgPath})
+	os.Stderr = stderr
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	// no daemon runs, but the PID file is known without the variable
+	if code != CODE_GENERAL_ERR || !strings.Contains(string(out), pidFile) {
+		t.Fatalf("expected the PID file to be read, got code %d: %s", code, out)
+		return
+	}
+}
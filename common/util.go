@@ -31,10 +31,45 @@ func GetBaseVarDir() string {
 	)
 }
 
+// GetDefaultLogFile returns where a daemonized daemon logs to by default.
+func GetDefaultLogFile() string {
+	if runtime.GOOS != "windows" && syscall.Getuid() == 0 {
+		return "/var/log/avail.log"
+	}
+
+	return filepath.Join(getStateHome(), "avail", "avail.log")
+}
+
+// GetDefaultStateFile returns where the daemon keeps the state of the sites
+// across restarts by default.
+func GetDefaultStateFile() string {
+	if runtime.GOOS != "windows" && syscall.Getuid() == 0 {
+		return "/var/lib/avail/state.json"
+	}
+
+	return filepath.Join(getStateHome(), "avail", "state.json")
+}
+
+func getStateHome() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return stateHome
+}
+
 func GetPidVarDir(pid int) string {
 	return filepath.Join(GetBaseVarDir(), fmt.Sprintf("%d", pid))
 }
 
+// CONTROL_SOCKET is the name of the daemon's control socket in its PID
+// directory.
+const CONTROL_SOCKET = "control.sock"
+
+func GetControlSocket(pid int) string {
+	return filepath.Join(GetPidVarDir(pid), CONTROL_SOCKET)
+}
+
 func NewSignalCtx(
 	ctx context.Context,
 ) context.Context {
@@ -91,18 +126,18 @@ func GetDefaultCfg() string {
 		configHome = filepath.Join(os.Getenv("HOME"), ".config")
 	}
 
-	locations := [...]string{
-		"avail.json",
-		filepath.Join(configHome, "avail.json"),
-		"/etc/avail.json",
-	}
+	dirs := [...]string{"", configHome, "/etc"}
+	names := [...]string{"avail.json", "avail.yaml", "avail.yml", "avail.toml"}
 
-	for _, path := range locations {
-		_, err := os.Stat(path)
-		if err == nil {
-			return path
+	for _, dir := range dirs {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			_, err := os.Stat(path)
+			if err == nil {
+				return path
+			}
 		}
 	}
 
-	return locations[0]
+	return names[0]
 }
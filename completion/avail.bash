@@ -22,15 +22,30 @@ _comp_cmd_avail() {
 	_comp_initialize -n : -- "$@" || return
 
 	local cmds
-	cmds="run status list schema http"
+	cmds="run stop restart reload status list check probe pause resume wait top init validate import export schema http"
 
-	local global_opts run_opts pid_opts status_opts list_opts schema_opts http_opts
+	local global_opts selector_opts run_opts stop_opts restart_opts reload_opts pid_opts output_opts status_opts list_opts check_opts probe_opts pause_opts resume_opts wait_opts top_opts init_opts validate_opts schema_opts http_opts
 	global_opts="-h -v"
-	run_opts="-h -c"
+	run_opts="-h -c -d -log"
 	pid_opts="-P -p -c"
-	status_opts="-h $pid_opts"
-	list_opts="-h $pid_opts"
-	schema_opts="-h"
+	stop_opts="-h -timeout -kill $pid_opts"
+	restart_opts="-h -timeout -kill -log $pid_opts"
+	output_opts="-format -template"
+	selector_opts="-l -group"
+	reload_opts="-h $pid_opts"
+	status_opts="-h -check -grouped $pid_opts $output_opts $selector_opts"
+	list_opts="-h $pid_opts $output_opts $selector_opts"
+	check_opts="-h -timeout $pid_opts $output_opts"
+	probe_opts="-h -c -title -timeout -proxy $output_opts"
+	pause_opts="-h -for $pid_opts $selector_opts"
+	resume_opts="-h $pid_opts $selector_opts"
+	wait_opts="-h -until -timeout -interval $pid_opts $selector_opts"
+	top_opts="-h -refresh $pid_opts $selector_opts"
+	init_opts="-h -c -from -f -timeout"
+	validate_opts="-h -c"
+	import_opts="-h -from -modules -o -f"
+	export_opts="-h -c -scrape -exporter -o -f"
+	schema_opts="-h -print -write"
 	http_opts="-h"
 
 	if [[ $cword -eq 1 ]]; then
@@ -45,11 +60,44 @@ _comp_cmd_avail() {
 		return
 	fi
 
+	if [[ $subcmd == check && $cword -eq 2 ]]; then
+		_comp_compgen -- -W "now"
+		return
+	fi
+
+	if [[ $prev == -format ]]; then
+		_comp_compgen -- -W "text json yaml csv tsv"
+		return
+	fi
+
+	if [[ $subcmd == import && ($prev == -from || $prev == --from) ]]; then
+		_comp_compgen -- -W "blackbox uptime-kuma gatus nagios"
+		return
+	fi
+
+	if [[ $prev == -until || $prev == --until ]]; then
+		_comp_compgen -- -W "up down"
+		return
+	fi
+
 	if [[ $cur == -* ]]; then
 		case "$subcmd" in
 		run) _comp_compgen -- -W "$run_opts" ;;
+		stop) _comp_compgen -- -W "$stop_opts" ;;
+		restart) _comp_compgen -- -W "$restart_opts" ;;
+		reload) _comp_compgen -- -W "$reload_opts" ;;
 		status) _comp_compgen -- -W "$status_opts" ;;
 		list) _comp_compgen -- -W "$list_opts" ;;
+		check) _comp_compgen -- -W "$check_opts" ;;
+		probe) _comp_compgen -- -W "$probe_opts" ;;
+		pause) _comp_compgen -- -W "$pause_opts" ;;
+		resume) _comp_compgen -- -W "$resume_opts" ;;
+		wait) _comp_compgen -- -W "$wait_opts" ;;
+		top) _comp_compgen -- -W "$top_opts" ;;
+		init) _comp_compgen -- -W "$init_opts" ;;
+		validate) _comp_compgen -- -W "$validate_opts" ;;
+		import) _comp_compgen -- -W "$import_opts" ;;
+		export) _comp_compgen -- -W "$export_opts" ;;
 		schema) _comp_compgen -- -W "$schema_opts" ;;
 		http) _comp_compgen -- -W "$http_opts" ;;
 		*) _comp_compgen -- -W "$global_opts" ;;
@@ -58,7 +106,7 @@ _comp_cmd_avail() {
 	fi
 
 	case "$subcmd" in
-	status)
+	status | wait | check | pause | resume)
 		local -a proc=()
 		_comp_xfunc_avail_get_proc proc "${words[@]}"
 		IFS=$'\n' read -rd '' -a titles <<<"$(
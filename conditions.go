@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StatusSet is a set of HTTP statuses, as single codes and as whole
+// classes, e.g. 3 for 3xx.
+type StatusSet struct {
+	Codes   []int
+	Classes []int
+}
+
+// StatusRange is the set of the statuses from lo to hi, inclusive.
+func StatusRange(lo, hi int) StatusSet {
+	var ret StatusSet
+	for code := max(lo, 100); code <= min(hi, 599); {
+		if code%100 == 0 && code+99 <= hi {
+			ret.Classes = append(ret.Classes, code/100)
+			code += 100
+		} else {
+			ret.Codes = append(ret.Codes, code)
+			code++
+		}
+	}
+	return ret
+}
+
+// Add adds the statuses of other to the set.
+func (this *StatusSet) Add(other StatusSet) {
+	for _, c := range other.Classes {
+		if !slices.Contains(this.Classes, c) {
+			this.Classes = append(this.Classes, c)
+		}
+	}
+	for _, c := range other.Codes {
+		if !slices.Contains(this.Codes, c) && !slices.Contains(this.Classes, c/100) {
+			this.Codes = append(this.Codes, c)
+		}
+	}
+	slices.Sort(this.Classes)
+	slices.Sort(this.Codes)
+}
+
+// IsDefault reports whether the set is 2xx, which sites expect without a
+// check.
+func (this StatusSet) IsDefault() bool {
+	return len(this.Codes) == 0 && slices.Equal(this.Classes, []int{2})
+}
+
+// Expand lists every status of the set.
+func (this StatusSet) Expand() []int {
+	ret := slices.Clone(this.Codes)
+	for _, c := range this.Classes {
+		for code := c * 100; code < (c+1)*100; code++ {
+			ret = append(ret, code)
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// pattern matches the statuses of the set, e.g. 204|3[0-9][0-9].
+func (this StatusSet) pattern() string {
+	alternatives := make([]string, 0)
+	for _, c := range this.Codes {
+		alternatives = append(alternatives, strconv.Itoa(c))
+	}
+	for _, c := range this.Classes {
+		alternatives = append(alternatives, strconv.Itoa(c)+"[0-9][0-9]")
+	}
+	return strings.Join(alternatives, "|")
+}
+
+var statusClass = regexp.MustCompile(`^([1-5])\[0-9\]\[0-9\]$`)
+
+func parseStatusPattern(pattern string) (StatusSet, bool) {
+	var ret StatusSet
+	for _, alternative := range strings.Split(pattern, "|") {
+		if m := statusClass.FindStringSubmatch(alternative); m != nil {
+			c, _ := strconv.Atoi(m[1])
+			ret.Classes = append(ret.Classes, c)
+			continue
+		}
+		code, err := strconv.Atoi(alternative)
+		if err != nil || code < 100 || code > 599 {
+			return StatusSet{}, false
+		}
+		ret.Codes = append(ret.Codes, code)
+	}
+	return ret, true
+}
+
+// CheckConditions are the conditions a response must meet beyond the 2xx
+// status sites expect by default. avail init and import turn them into
+// shell checks, which avail export turns back into conditions.
+type CheckConditions struct {
+	// nil for 2xx
+	Statuses *StatusSet
+	// extended regular expressions a line of the body must match, or that
+	// no line may match
+	Matches    []string
+	NotMatches []string
+}
+
+// Check is the shell check of the conditions, or nil if there are none.
+func (this CheckConditions) Check() *InitCheck {
+	parts := make([]string, 0)
+	if this.Statuses != nil && !this.Statuses.IsDefault() {
+		s := this.Statuses
+		if len(s.Codes) == 1 && len(s.Classes) == 0 {
+			parts = append(parts, fmt.Sprintf(`[ "$(avail http status)" = %d ]`, s.Codes[0]))
+		} else {
+			parts = append(parts, "avail http status | grep -Eqx "+shellQuote(s.pattern()))
+		}
+	}
+	for _, m := range this.Matches {
+		parts = append(parts, "avail http body | grep -Eq "+shellQuote(m))
+	}
+	for _, m := range this.NotMatches {
+		parts = append(parts, "! avail http body | grep -Eq "+shellQuote(m))
+	}
+
+	if len(parts) == 0 {
+		return nil
+	}
+	return &InitCheck{Type: "shell", Script: strings.Join(parts, " && ")}
+}
+
+const quoted = `('(?:[^']|'\\'')*')`
+
+var (
+	statusCondition   = regexp.MustCompile(`^\[ "\$\(avail http status\)" = ([0-9]{3}) \]`)
+	statusesCondition = regexp.MustCompile(`^avail http status \| grep -Eqx ` + quoted)
+	bodyCondition     = regexp.MustCompile(`^(! )?avail http body \| grep -Eq ` + quoted)
+)
+
+// ParseCheckConditions parses the script of a check created by
+// CheckConditions.Check. Any other script is not understood.
+func ParseCheckConditions(script string) (CheckConditions, bool) {
+	var ret CheckConditions
+	rest := strings.TrimSpace(script)
+	for {
+		if m := statusCondition.FindStringSubmatch(rest); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			ret.Statuses = &StatusSet{Codes: []int{code}}
+			rest = rest[len(m[0]):]
+		} else if m := statusesCondition.FindStringSubmatch(rest); m != nil {
+			statuses, ok := parseStatusPattern(shellUnquote(m[1]))
+			if !ok {
+				return CheckConditions{}, false
+			}
+			ret.Statuses = &statuses
+			rest = rest[len(m[0]):]
+		} else if m := bodyCondition.FindStringSubmatch(rest); m != nil {
+			if m[1] == "" {
+				ret.Matches = append(ret.Matches, shellUnquote(m[2]))
+			} else {
+				ret.NotMatches = append(ret.NotMatches, shellUnquote(m[2]))
+			}
+			rest = rest[len(m[0]):]
+		} else {
+			return CheckConditions{}, false
+		}
+
+		if rest == "" {
+			return ret, true
+		}
+		var ok bool
+		rest, ok = strings.CutPrefix(rest, " && ")
+		if !ok {
+			return CheckConditions{}, false
+		}
+	}
+}
+
+// jsonFieldPattern matches a top-level field of a JSON body, e.g.
+// "status": "ok". Values other than strings, e.g. numbers, are matched
+// unquoted.
+func jsonFieldPattern(key, value string, isString bool) string {
+	if isString {
+		return fmt.Sprintf(`"%s" *: *"%s"`, regexp.QuoteMeta(key), regexp.QuoteMeta(value))
+	}
+	return fmt.Sprintf(
+		`"%s" *: *%s *([,}]|$)`, regexp.QuoteMeta(key), regexp.QuoteMeta(value),
+	)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellUnquote(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+	return strings.ReplaceAll(s, `'\''`, "'")
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// String names the source in logs and errors, e.g. files teams/*.json.
+func (this *Discovery) String() string {
+	if this.Files != nil {
+		return "files " + *this.Files
+	}
+	if this.Command != nil {
+		return "command " + Redact(*this.Command)
+	}
+	return "discovery"
+}
+
+// checkDiscovery checks that each source sets exactly one of files and
+// command, and extends a known template.
+func checkDiscovery(c *Config) error {
+	for i, d := range c.Discovery {
+		if (d.Files == nil) == (d.Command == nil) {
+			return fmt.Errorf("discovery %d: exactly one of files and command must be set", i)
+		}
+		if d.Extends != nil {
+			_, ok := c.Templates[*d.Extends]
+			if !ok {
+				return fmt.Errorf("discovery %d: unknown template \"%s\"", i, *d.Extends)
+			}
+		}
+	}
+	return nil
+}
+
+// DiscoveryFiles resolves the files pattern of a source relative to the
+// config file at path.
+func DiscoveryFiles(path string, d *Discovery) ([]string, error) {
+	if d.Files == nil {
+		return nil, nil
+	}
+
+	pattern := *d.Files
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery pattern: %w", err)
+	}
+	return matches, nil
+}
+
+// ParseDiscovered parses the sites listed by a discovery source, in the
+// format of name's extension or detected from the content. The sites take
+// the fields they do not set from the source's template and then from the
+// defaults, the same way as the sites of included files.
+func (this *Config) ParseDiscovered(name string, b []byte, d *Discovery) ([]Ping, error) {
+	listed, err := decodeAny(DetectFormat(name, b), b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var raw map[string]any
+	switch v := listed.(type) {
+	case []any:
+		raw = map[string]any{"sites": v}
+	case map[string]any:
+		raw = v
+		for k := range raw {
+			if k != "sites" && k != "$schema" {
+				return nil, fmt.Errorf("%s: discovered configs may only define sites", name)
+			}
+		}
+	case nil:
+		return []Ping{}, nil
+	default:
+		return nil, fmt.Errorf("%s: expected a list of sites", name)
+	}
+
+	_, err = interpolateAll(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	sites, _ := raw["sites"].([]any)
+	for _, s := range sites {
+		site, ok := s.(map[string]any)
+		if !ok || d.Extends == nil {
+			continue
+		}
+		_, ok = site["extends"]
+		if !ok {
+			site["extends"] = *d.Extends
+		}
+	}
+
+	defaults, err := toRaw(this.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := toRaw(this.Templates)
+	if err != nil {
+		return nil, err
+	}
+	err = expandSites(raw, defaults, templates)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	c, err := parseConfig(name, raw)
+	if err != nil {
+		return nil, err
+	}
+	// titles name directories, which discovered ones must not escape
+	for _, site := range c.Sites {
+		err = CheckTitle(site.Title)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return c.Sites, nil
+}
+
+// decodeAny decodes a document of any format, unlike ToJson also accepting
+// a list at the top.
+func decodeAny(format Format, b []byte) (any, error) {
+	var err error
+	var v any
+	switch format {
+	case FORMAT_TOML:
+		// TOML documents are tables
+		b, err = ToJson(format, b)
+	case FORMAT_YAML:
+		err = yaml.Unmarshal(b, &v)
+		if err == nil {
+			b, err = json.Marshal(v)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v = nil
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// toRaw converts a part of a parsed config back to decoded JSON.
+func toRaw(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret any
+	err = json.Unmarshal(b, &ret)
+	return ret, err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/thekhanj/avail/common"
 )
@@ -17,6 +18,36 @@ func (this *Config) GetPidFile() string {
 	return filepath.Join(common.GetBaseVarDir(), "main.pid")
 }
 
+func (this *Config) GetLog() *Log {
+	if this.Log != nil {
+		return this.Log
+	}
+
+	return &Log{Format: LogFormatText, Level: LogLevelInfo}
+}
+
+// GetRunDir returns the configured runDir. Otherwise, daemons with their
+// own pidFile get their own runDir next to it, e.g. /run/web for
+// /run/web.pid, so that they can run side by side.
+func (this *Config) GetRunDir() string {
+	if this.RunDir != nil {
+		return *this.RunDir
+	}
+	if this.PidFile != nil {
+		return strings.TrimSuffix(*this.PidFile, filepath.Ext(*this.PidFile))
+	}
+
+	return common.GetBaseVarDir()
+}
+
+func (this *Config) GetStateFile() string {
+	if this.StateFile != nil {
+		return *this.StateFile
+	}
+
+	return common.GetDefaultStateFile()
+}
+
 func (this *Ping) GetCheck() (Check, error) {
 	if this.Check == nil {
 		return nil, nil
@@ -49,8 +80,74 @@ func (this *Ping) GetCheck() (Check, error) {
 	return nil, invalidErr
 }
 
-func ReadConfig(path string) (*Config, error) {
+// ReadPidFile returns the pidFile of a config file without interpolating
+// the rest of it, whose variables e.g. users only reading the status of the
+// daemon need not have.
+func ReadPidFile(path string) (string, error) {
 	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	b, err = ToJson(DetectFormat(path, b), b)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	var raw struct {
+		PidFile *string `json:"pidFile"`
+	}
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	c := Config{}
+	if raw.PidFile != nil {
+		pidFile, err := Interpolate(*raw.PidFile)
+		if err != nil {
+			return "", fmt.Errorf("%s: pidFile: %w", path, err)
+		}
+		c.PidFile = &pidFile
+	}
+
+	return c.GetPidFile(), nil
+}
+
+// readRawConfig reads a config file of any format as decoded JSON, with its
+// strings interpolated.
+func readRawConfig(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = ToJson(DetectFormat(path, b), b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var raw map[string]any
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	_, err = interpolateAll(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return raw, nil
+}
+
+// parseConfig validates a raw config read from path against the schema.
+func parseConfig(path string, raw map[string]any) (*Config, error) {
+	err := validateSchema(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	b, err := json.Marshal(raw)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +155,7 @@ func ReadConfig(path string) (*Config, error) {
 	var c Config
 	err = c.UnmarshalJSON(b)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
 	return &c, nil
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/thekhanj/avail/common"
+)
+
+func TestGetRunDir(t *testing.T) {
+	pidFile := "/run/web.pid"
+	runDir := "/run/avail-web"
+
+	for _, tc := range []struct {
+		cfg      Config
+		expected string
+	}{
+		{Config{}, common.GetBaseVarDir()},
+		{Config{PidFile: &pidFile}, "/run/web"},
+		{Config{PidFile: &pidFile, RunDir: &runDir}, runDir},
+	} {
+		if dir := tc.cfg.GetRunDir(); dir != tc.expected {
+			t.Fatalf("expected %s, got %s", tc.expected, dir)
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FORMAT_JSON Format = "json"
+	FORMAT_YAML Format = "yaml"
+	FORMAT_TOML Format = "toml"
+)
+
+// CONFIG_EXTENSIONS are the extensions of the supported config files.
+var CONFIG_EXTENSIONS = []string{".json", ".yaml", ".yml", ".toml"}
+
+// matches the first line of a TOML document, a table or a key/value pair
+var tomlLine = regexp.MustCompile(`^(\[.*\]|[A-Za-z0-9_."'-]+\s*=.*)$`)
+
+// DetectFormat selects the format of a config file by its extension, or by
+// its content if the extension is unknown.
+func DetectFormat(path string, b []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FORMAT_JSON
+	case ".yaml", ".yml":
+		return FORMAT_YAML
+	case ".toml":
+		return FORMAT_TOML
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return FORMAT_JSON
+	}
+	// a TOML table looks like an array at first, e.g. of discovered sites
+	if bytes.HasPrefix(trimmed, []byte("[")) && json.Valid(trimmed) {
+		return FORMAT_JSON
+	}
+
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tomlLine.MatchString(line) {
+			return FORMAT_TOML
+		}
+		break
+	}
+
+	return FORMAT_YAML
+}
+
+// ToJson converts a config in the given format to JSON, so that it is
+// validated the same way regardless of the format.
+func ToJson(format Format, b []byte) ([]byte, error) {
+	var v map[string]any
+
+	switch format {
+	case FORMAT_JSON:
+		return b, nil
+	case FORMAT_YAML:
+		err := yaml.Unmarshal(b, &v)
+		if err != nil {
+			return nil, err
+		}
+	case FORMAT_TOML:
+		err := toml.Unmarshal(b, &v)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format: %s", format)
+	}
+
+	return json.Marshal(v)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"avail.json": `{
+  "sites": [
+    {
+      "title": "music",
+      "url": "https://music.youtube.com/",
+      "interval": "5m",
+      "check": {"type": "shell", "script": "[ \"$(avail http status)\" -eq 200 ]"}
+    }
+  ]
+}`,
+		"avail.yaml": `
+sites:
+  - title: music
+    url: https://music.youtube.com/
+    interval: 5m
+    check:
+      type: shell
+      script: '[ "$(avail http status)" -eq 200 ]'
+`,
+		"avail.toml": `
+[[sites]]
+title = "music"
+url = "https://music.youtube.com/"
+interval = "5m"
+
+[sites.check]
+type = "shell"
+script = '[ "$(avail http status)" -eq 200 ]'
+`,
+	}
+
+	var expected *Config
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		cfg, err := ReadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+			return
+		}
+		if expected == nil {
+			expected = cfg
+		} else if !reflect.DeepEqual(cfg, expected) {
+			t.Fatalf("%s: got %+v, expected %+v", name, cfg, expected)
+			return
+		}
+
+		// without an extension, the format is detected from the content
+		if DetectFormat("config", []byte(content)) != DetectFormat(name, nil) {
+			t.Fatalf("%s: format not detected from content", name)
+			return
+		}
+	}
+
+	path := filepath.Join(dir, "invalid.yaml")
+	err := os.WriteFile(path, []byte("pidFile: /tmp/avail.pid\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	_, err = ReadConfig(path)
+	if err == nil {
+		t.Fatal("expected the schema to be enforced for YAML")
+		return
+	}
+}
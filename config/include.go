@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ReadConfig reads a config file along with the sites of the files it
+// includes, followed by the ones of its drop-in directory (see DropInDir).
+// Included files may only define sites, which take their defaults and
+// templates from the including file.
+func ReadConfig(path string) (*Config, error) {
+	raw, err := readRawConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	defaults, templates := raw["defaults"], raw["templates"]
+
+	err = expandSites(raw, defaults, templates)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c, err := parseConfig(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDiscovery(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	files, err := includedFiles(path, c.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string)
+	addSites := func(file string, sites []Ping) error {
+		for _, site := range sites {
+			src, ok := sources[site.Title]
+			if ok {
+				return fmt.Errorf(
+					"duplicate site title \"%s\" in %s and %s", site.Title, src, file,
+				)
+			}
+			sources[site.Title] = file
+		}
+		return nil
+	}
+
+	err = addSites(path, c.Sites)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		rawIncluded, err := readRawConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		err = expandSites(rawIncluded, defaults, templates)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		included, err := parseConfig(file, rawIncluded)
+		if err != nil {
+			return nil, err
+		}
+
+		sites := included.Sites
+		included.Sites = nil
+		included.Schema = nil
+		if included.Include != nil {
+			return nil, fmt.Errorf("%s: included files cannot include others", file)
+		}
+		if !reflect.ValueOf(*included).IsZero() {
+			return nil, fmt.Errorf("%s: included files may only define sites", file)
+		}
+
+		err = addSites(file, sites)
+		if err != nil {
+			return nil, err
+		}
+		c.Sites = append(c.Sites, sites...)
+	}
+
+	return c, nil
+}
+
+// DropInDir returns the directory whose files are included by the config
+// file automatically, e.g. /etc/avail.d for /etc/avail.json.
+func DropInDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".d"
+}
+
+// includedFiles resolves the include patterns relative to the config file
+// and appends the files of the drop-in directory. Each file is listed once.
+func includedFiles(path string, patterns []string) ([]string, error) {
+	dir := filepath.Dir(path)
+	ret := make([]string, 0)
+	seen := map[string]bool{filepath.Clean(path): true}
+
+	add := func(file string) {
+		file = filepath.Clean(file)
+		if !seen[file] {
+			seen[file] = true
+			ret = append(ret, file)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern: %w", path, err)
+		}
+		for _, m := range matches {
+			add(m)
+		}
+	}
+
+	entries, err := os.ReadDir(DropInDir(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || !slices.Contains(CONFIG_EXTENSIONS, ext) {
+			continue
+		}
+		add(filepath.Join(DropInDir(path), e.Name()))
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := write("avail.json", `{"include": ["teams/*.yaml"], "sites": [
+		{"title": "main", "url": "https://example.com"}
+	]}`)
+	write("teams/a.yaml", "sites: [{title: a, url: 'https://a.example.com'}]\n")
+	write("teams/b.yaml", "sites: [{title: b, url: 'https://b.example.com'}]\n")
+	write("avail.d/c.toml", "[[sites]]\ntitle = 'c'\nurl = 'https://c.example.com'\n")
+	write("avail.d/README", "not a config")
+
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	titles := make([]string, 0)
+	for _, site := range cfg.Sites {
+		titles = append(titles, site.Title)
+	}
+	if strings.Join(titles, ",") != "main,a,b,c" {
+		t.Fatalf("unexpected sites: %v", titles)
+		return
+	}
+
+	dup := write("avail.d/dup.yaml", "sites: [{title: a, url: 'https://a.example.com'}]\n")
+	_, err = ReadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "teams/a.yaml")) ||
+		!strings.Contains(err.Error(), dup) {
+		t.Fatalf("expected duplicate error naming both files, got %v", err)
+		return
+	}
+	os.Remove(dup)
+
+	write("avail.d/pid.yaml", "pidFile: /tmp/avail.pid\nsites: []\n")
+	_, err = ReadConfig(path)
+	if err == nil {
+		t.Fatal("expected included files to be limited to sites")
+		return
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MIN_SECRET_LENGTH is the length below which interpolated values are not
+// redacted, as they would garble the output.
+const MIN_SECRET_LENGTH = 4
+
+const REDACTED = "***"
+
+// matches $${ (an escaped ${) and ${...}
+var interpolation = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+var secrets = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// Interpolate substitutes ${NAME} and ${NAME:-default} with environment
+// variables and ${file:/path} with the content of a file, without its
+// trailing newline. $${ is kept as a literal ${. The values taken from the
+// environment and from files are redacted by Redact from now on.
+func Interpolate(s string) (string, error) {
+	return interpolate(s, false)
+}
+
+// InterpolateScript interpolates the script of a shell check like
+// Interpolate, except that references to unset variables, e.g. the ${i} of
+// a loop, are left to the shell.
+func InterpolateScript(s string) (string, error) {
+	return interpolate(s, true)
+}
+
+func interpolate(s string, script bool) (string, error) {
+	var err error
+
+	ret := interpolation.ReplaceAllStringFunc(s, func(m string) string {
+		if err != nil {
+			return m
+		}
+		if m == "$${" {
+			return "${"
+		}
+
+		expr := m[2 : len(m)-1]
+		v, rerr := resolve(expr)
+		if rerr != nil {
+			if script && !strings.HasPrefix(expr, "file:") {
+				return m
+			}
+			err = rerr
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func resolve(expr string) (string, error) {
+	if path, ok := strings.CutPrefix(expr, "file:"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		v := strings.TrimRight(string(b), "\r\n")
+		addSecret(v)
+		return v, nil
+	}
+
+	name, def, hasDef := strings.Cut(expr, ":-")
+	if name == "" {
+		return "", fmt.Errorf("invalid interpolation \"${%s}\"", expr)
+	}
+
+	v, ok := os.LookupEnv(name)
+	if hasDef && v == "" {
+		return def, nil
+	}
+	if !ok {
+		return "", fmt.Errorf(
+			"environment variable %s is not set (use $${%s} for a literal)",
+			name, expr,
+		)
+	}
+
+	addSecret(v)
+	return v, nil
+}
+
+func addSecret(v string) {
+	if len(v) < MIN_SECRET_LENGTH {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	if slices.Contains(secrets.values, v) {
+		return
+	}
+	secrets.values = append(secrets.values, v)
+	// longest first, so that a secret containing another one is hidden whole
+	slices.SortFunc(secrets.values, func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+}
+
+// Redact hides the values interpolated into configs from s.
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+
+	for _, v := range secrets.values {
+		s = strings.ReplaceAll(s, v, REDACTED)
+	}
+	return s
+}
+
+// interpolateAt interpolates the string at ptr of a config, which is a
+// shell script if ptr points to the script of a check.
+func interpolateAt(ptr string, s string) (string, error) {
+	if strings.HasSuffix(ptr, "/check/script") {
+		return InterpolateScript(s)
+	}
+	return Interpolate(s)
+}
+
+// JoinPointer appends a reference token to a JSON pointer.
+func JoinPointer(ptr string, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return ptr + "/" + token
+}
+
+// interpolateAll interpolates every string in a decoded JSON value.
+func interpolateAll(v any) (any, error) {
+	return interpolateAllAt("", v)
+}
+
+func interpolateAllAt(ptr string, v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return interpolateAt(ptr, v)
+	case []any:
+		for i := range v {
+			var err error
+			v[i], err = interpolateAllAt(JoinPointer(ptr, strconv.Itoa(i)), v[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for k := range v {
+			var err error
+			v[k], err = interpolateAllAt(JoinPointer(ptr, k), v[k])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return v, nil
+}
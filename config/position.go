@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a location in a config file, 1-based.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (this Position) String() string {
+	return fmt.Sprintf("%d:%d", this.Line, this.Column)
+}
+
+// Positions maps JSON pointers (e.g. /sites/0/url) of a config file to
+// where they are defined: the key of object members and the start of
+// array items.
+type Positions map[string]Position
+
+// Find returns the position of ptr, or of its closest parent found.
+func (this Positions) Find(ptr string) Position {
+	for {
+		pos, ok := this[ptr]
+		if ok {
+			return pos
+		}
+
+		i := strings.LastIndex(ptr, "/")
+		if i < 0 {
+			return Position{1, 1}
+		}
+		ptr = ptr[:i]
+	}
+}
+
+// Locate finds the positions of the values of a config file.
+func Locate(format Format, b []byte) (Positions, error) {
+	switch format {
+	case FORMAT_JSON:
+		return locateJson(b)
+	case FORMAT_YAML:
+		return locateYaml(b)
+	case FORMAT_TOML:
+		return locateToml(b)
+	default:
+		return nil, fmt.Errorf("unknown config format: %s", format)
+	}
+}
+
+// ErrorPosition extracts the position of a syntax error, if known.
+func ErrorPosition(b []byte, err error) (Position, bool) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return offsetPosition(b, int(syntaxErr.Offset)), true
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return offsetPosition(b, int(typeErr.Offset)), true
+	}
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, column := decodeErr.Position()
+		return Position{line, column}, true
+	}
+
+	m := yamlErrorLine.FindStringSubmatch(err.Error())
+	if m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Position{line, 1}, true
+	}
+
+	return Position{}, false
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+):`)
+
+func offsetPosition(b []byte, offset int) Position {
+	offset = min(offset, len(b))
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return Position{line, column}
+}
+
+func locateJson(b []byte) (Positions, error) {
+	ret := Positions{"": {1, 1}}
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	// start of the next token, the decoder skips separators lazily
+	next := func() Position {
+		i := int(dec.InputOffset())
+		for i < len(b) && strings.IndexByte(" \t\r\n:,", b[i]) >= 0 {
+			i++
+		}
+		return offsetPosition(b, i)
+	}
+
+	var walk func(ptr string) error
+	walk = func(ptr string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				pos := next()
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := JoinPointer(ptr, fmt.Sprint(key))
+				ret[child] = pos
+
+				err = walk(child)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				child := JoinPointer(ptr, strconv.Itoa(i))
+				ret[child] = next()
+
+				err := walk(child)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+
+		return nil
+	}
+
+	err := walk("")
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func locateYaml(b []byte) (Positions, error) {
+	ret := Positions{"": {1, 1}}
+
+	var doc yaml.Node
+	err := yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var walk func(ptr string, n *yaml.Node)
+	walk = func(ptr string, n *yaml.Node) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(ptr, c)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				child := JoinPointer(ptr, key.Value)
+				ret[child] = Position{key.Line, key.Column}
+				walk(child, value)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				child := JoinPointer(ptr, strconv.Itoa(i))
+				ret[child] = Position{c.Line, c.Column}
+				walk(child, c)
+			}
+		}
+	}
+	walk("", &doc)
+
+	return ret, nil
+}
+
+func locateToml(b []byte) (Positions, error) {
+	ret := Positions{"": {1, 1}}
+
+	p := unstable.Parser{}
+	p.Reset(b)
+
+	position := func(n *unstable.Node) Position {
+		shape := p.Shape(n.Raw)
+		return Position{shape.Start.Line, shape.Start.Column}
+	}
+
+	// current index of the arrays of tables, by their dotted path
+	arrays := make(map[string]int)
+	// resolves dotted keys, descending into the current array items
+	resolve := func(base string, it unstable.Iterator, record bool) string {
+		ptr := base
+		dotted := base
+		for it.Next() {
+			n := it.Node()
+			key := string(n.Data)
+			ptr = JoinPointer(ptr, key)
+			dotted += "." + key
+			if record {
+				ret[ptr] = position(n)
+			}
+
+			idx, ok := arrays[dotted]
+			if ok && !it.IsLast() {
+				ptr = JoinPointer(ptr, strconv.Itoa(idx))
+			}
+		}
+		return ptr
+	}
+
+	var value func(ptr string, n *unstable.Node)
+	value = func(ptr string, n *unstable.Node) {
+		switch n.Kind {
+		case unstable.Array:
+			it := n.Children()
+			for i := 0; it.Next(); i++ {
+				child := JoinPointer(ptr, strconv.Itoa(i))
+				ret[child] = position(it.Node())
+				value(child, it.Node())
+			}
+		case unstable.InlineTable:
+			it := n.Children()
+			for it.Next() {
+				kv := it.Node()
+				child := resolve(ptr, kv.Key(), true)
+				value(child, kv.Value())
+			}
+		}
+	}
+
+	table := ""
+	for p.NextExpression() {
+		e := p.Expression()
+
+		switch e.Kind {
+		case unstable.Table:
+			table = resolve("", e.Key(), true)
+		case unstable.ArrayTable:
+			dotted := ""
+			it := e.Key()
+			for it.Next() {
+				dotted += "." + string(it.Node().Data)
+			}
+			idx, ok := arrays[dotted]
+			if ok {
+				idx++
+			}
+			arrays[dotted] = idx
+
+			table = resolve("", e.Key(), true)
+			pos := ret[table]
+			table = JoinPointer(table, strconv.Itoa(idx))
+			ret[table] = pos
+		case unstable.KeyValue:
+			ptr := resolve(table, e.Key(), true)
+			value(ptr, e.Value())
+		}
+	}
+
+	err := p.Error()
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+var schema struct {
+	sync.Mutex
+	source   []byte
+	compiled *jsonschema.Schema
+}
+
+// SetSchema sets the JSON schema config files are validated against, on top
+// of the checks of the generated code. The main package sets the schema
+// embedded in the binary, so that configs are validated exactly the way the
+// editors using the schema do.
+func SetSchema(b []byte) {
+	schema.Lock()
+	defer schema.Unlock()
+
+	schema.source = b
+	schema.compiled = nil
+}
+
+// CompileSchema compiles the schema set by SetSchema, once.
+func CompileSchema() (*jsonschema.Schema, error) {
+	schema.Lock()
+	defer schema.Unlock()
+
+	if schema.compiled != nil {
+		return schema.compiled, nil
+	}
+	if schema.source == nil {
+		return nil, errors.New("no config schema is set")
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema.source))
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	err = c.AddResource("schema.json", doc)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := c.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+
+	schema.compiled = compiled
+	return compiled, nil
+}
+
+// validateSchema validates a raw config against the schema, if one is set.
+// The first problem is reported, avail validate lists them all.
+func validateSchema(raw map[string]any) error {
+	schema.Lock()
+	unset := schema.source == nil
+	schema.Unlock()
+	if unset {
+		return nil
+	}
+
+	s, err := CompileSchema()
+	if err != nil {
+		return err
+	}
+
+	err = s.Validate(any(raw))
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	leaves := schemaLeaves(validationErr)
+	first := leaves[0]
+	ptr := "/"
+	if len(first.InstanceLocation) != 0 {
+		ptr = ""
+		for _, token := range first.InstanceLocation {
+			ptr = JoinPointer(ptr, token)
+		}
+	}
+
+	ret := fmt.Errorf("%s: %s", ptr, first.ErrorKind.LocalizedString(printer))
+	if len(leaves) > 1 {
+		ret = fmt.Errorf(
+			"%w (and %d more, see avail validate)", ret, len(leaves)-1,
+		)
+	}
+	return ret
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigSchema(t *testing.T) {
+	b, err := os.ReadFile("../schema.json")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	SetSchema(b)
+	defer SetSchema(nil)
+
+	path := filepath.Join(t.TempDir(), "avail.yaml")
+	err = os.WriteFile(path, []byte(`sites:
+  - title: a
+    url: https://example.com
+    proxy: ftp://localhost
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	_, err = ReadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "/sites/0/proxy") {
+		t.Fatalf("expected the schema to reject the proxy, got %v", err)
+		return
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import "fmt"
+
+// expandSites fills in the fields the sites of a raw config do not set,
+// from the template they extend and then from the defaults. Fields are
+// taken whole, e.g. a check is never merged with the template's one.
+func expandSites(raw map[string]any, defaults, templates any) error {
+	sites, _ := raw["sites"].([]any)
+	named, _ := templates.(map[string]any)
+	defaultFields, _ := defaults.(map[string]any)
+
+	for _, s := range sites {
+		site, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if name, ok := site["extends"].(string); ok {
+			template, ok := named[name].(map[string]any)
+			if !ok {
+				return fmt.Errorf("site %v: unknown template \"%s\"", site["title"], name)
+			}
+			fillFields(site, template)
+		}
+		fillFields(site, defaultFields)
+	}
+
+	return nil
+}
+
+func fillFields(site, from map[string]any) {
+	for k, v := range from {
+		_, ok := site[k]
+		if !ok {
+			site[k] = v
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigTemplates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "avail.yaml")
+	err := os.WriteFile(path, []byte(`
+defaults:
+  interval: 1m
+  proxy: socks5://127.0.0.1:9050
+templates:
+  slow:
+    interval: 10m
+    timeout: 1m
+    check: {type: shell, script: "true"}
+sites:
+  - {title: a, url: "https://a.example.com"}
+  - {title: b, url: "https://b.example.com", extends: slow}
+  - {title: c, url: "https://c.example.com", extends: slow, interval: 5s}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	err = os.MkdirAll(filepath.Join(dir, "avail.d"), 0755)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	err = os.WriteFile(
+		filepath.Join(dir, "avail.d", "d.yaml"),
+		[]byte("sites: [{title: d, url: 'https://d.example.com', extends: slow}]\n"),
+		0644,
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	a, b, c, d := cfg.Sites[0], cfg.Sites[1], cfg.Sites[2], cfg.Sites[3]
+	if a.Interval != "1m" || a.Timeout != "30s" || a.Check != nil ||
+		a.Proxy == nil || *a.Proxy != "socks5://127.0.0.1:9050" {
+		t.Fatalf("defaults not applied: %+v", a)
+		return
+	}
+	if b.Interval != "10m" || b.Timeout != "1m" || b.Check == nil || b.Proxy == nil {
+		t.Fatalf("template not applied: %+v", b)
+		return
+	}
+	if c.Interval != "5s" || c.Timeout != "1m" {
+		t.Fatalf("site fields must take precedence: %+v", c)
+		return
+	}
+	if d.Interval != "10m" {
+		t.Fatalf("included sites must use the templates: %+v", d)
+		return
+	}
+
+	err = os.WriteFile(path, []byte(
+		"sites: [{title: a, url: 'https://a.example.com', extends: missing}]\n",
+	), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	_, err = ReadConfig(path)
+	if err == nil {
+		t.Fatal("expected unknown templates to be rejected")
+		return
+	}
+}
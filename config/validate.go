@@ -0,0 +1,515 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"github.com/thekhanj/avail/common"
+)
+
+// Problem is an issue found by Validate.
+type Problem struct {
+	File     string
+	Position Position
+	Message  string
+}
+
+func (this Problem) String() string {
+	return fmt.Sprintf("%s:%s: %s", this.File, this.Position, this.Message)
+}
+
+// Validate checks a config file and the files it includes against the
+// schema, and for mistakes the schema cannot express, e.g. duplicate titles
+// or exec checks of missing binaries. Unlike ReadConfig, it does not stop at
+// the first problem. The error is only for failures to read the files.
+func Validate(path string, schema *jsonschema.Schema) ([]Problem, error) {
+	v := validator{schema: schema, titles: make(map[string]Problem)}
+
+	main, err := v.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if main == nil {
+		return v.problems, nil
+	}
+	defaults, templates := main.raw["defaults"], main.raw["templates"]
+	v.checkTemplates(main, defaults, templates)
+	v.checkSites(main, defaults, templates)
+	v.checkDiscovery(main, templates)
+
+	patterns := make([]string, 0)
+	for _, p := range asSlice(main.raw["include"]) {
+		if s, ok := p.(string); ok {
+			patterns = append(patterns, s)
+		}
+	}
+	files, err := includedFiles(path, patterns)
+	if err != nil {
+		v.add(main, "/include", err.Error())
+		files = nil
+	}
+
+	for _, file := range files {
+		included, err := v.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if included == nil {
+			continue
+		}
+
+		for k := range included.raw {
+			if k != "sites" && k != "$schema" {
+				v.add(
+					included, JoinPointer("", k), "included files may only define sites",
+				)
+			}
+		}
+		v.checkSites(included, defaults, templates)
+	}
+
+	order := append([]string{path}, files...)
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(order, a.File), slices.Index(order, b.File)),
+			cmp.Compare(a.Position.Line, b.Position.Line),
+			cmp.Compare(a.Position.Column, b.Position.Column),
+		)
+	})
+
+	return v.problems, nil
+}
+
+type validator struct {
+	schema   *jsonschema.Schema
+	problems []Problem
+	// where each site title is first defined
+	titles map[string]Problem
+}
+
+type validatedFile struct {
+	path      string
+	raw       map[string]any
+	positions Positions
+}
+
+func (this *validator) add(file *validatedFile, ptr string, msg string) {
+	this.problems = append(this.problems, Problem{
+		File:     file.path,
+		Position: file.positions.Find(ptr),
+		Message:  msg,
+	})
+}
+
+// readFile parses a config file and checks it against the schema. It
+// returns nil if the file cannot be parsed, after adding the problem.
+func (this *validator) readFile(path string) (*validatedFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := DetectFormat(path, b)
+	syntaxErr := func(err error) (*validatedFile, error) {
+		pos, _ := ErrorPosition(b, err)
+		if pos.Line == 0 {
+			pos = Position{1, 1}
+		}
+		this.problems = append(this.problems, Problem{path, pos, err.Error()})
+		return nil, nil
+	}
+
+	positions, err := Locate(format, b)
+	if err != nil {
+		return syntaxErr(err)
+	}
+	j, err := ToJson(format, b)
+	if err != nil {
+		return syntaxErr(err)
+	}
+	var raw map[string]any
+	err = json.Unmarshal(j, &raw)
+	if err != nil {
+		return syntaxErr(err)
+	}
+
+	file := &validatedFile{path, raw, positions}
+	this.interpolate(file, "", raw)
+
+	err = this.schema.Validate(any(raw))
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		this.addSchemaErrors(file, validationErr)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// interpolate interpolates the strings of v in place, adding a problem for
+// each one that fails.
+func (this *validator) interpolate(file *validatedFile, ptr string, v any) {
+	switch v := v.(type) {
+	case []any:
+		for i, item := range v {
+			child := JoinPointer(ptr, strconv.Itoa(i))
+			if s, ok := item.(string); ok {
+				v[i] = this.interpolateString(file, child, s)
+			} else {
+				this.interpolate(file, child, item)
+			}
+		}
+	case map[string]any:
+		for k, item := range v {
+			child := JoinPointer(ptr, k)
+			if s, ok := item.(string); ok {
+				v[k] = this.interpolateString(file, child, s)
+			} else {
+				this.interpolate(file, child, item)
+			}
+		}
+	}
+}
+
+func (this *validator) interpolateString(
+	file *validatedFile, ptr string, s string,
+) string {
+	ret, err := interpolateAt(ptr, s)
+	if err != nil {
+		this.add(file, ptr, err.Error())
+		return s
+	}
+	return ret
+}
+
+var printer = message.NewPrinter(language.English)
+
+func (this *validator) addSchemaErrors(
+	file *validatedFile, err *jsonschema.ValidationError,
+) {
+	seen := make(map[string]bool)
+	for _, leaf := range schemaLeaves(err) {
+		ptr := ""
+		for _, token := range leaf.InstanceLocation {
+			ptr = JoinPointer(ptr, token)
+		}
+
+		_, isPattern := leaf.ErrorKind.(*kind.Pattern)
+		loc := leaf.InstanceLocation
+		if isPattern && len(loc) != 0 && slices.Contains(CHECKED_FIELDS, loc[len(loc)-1]) {
+			// see checkFields
+			continue
+		}
+
+		msg := leaf.ErrorKind.LocalizedString(printer)
+		if seen[ptr+"\x00"+msg] {
+			continue
+		}
+		seen[ptr+"\x00"+msg] = true
+
+		this.add(file, ptr, msg)
+	}
+}
+
+// schemaLeaves returns the errors that caused a validation error. Of the
+// subschemas of a failed oneOf (the kinds of checks), only the ones whose
+// type matches are considered, so that a shell check is not reported to
+// lack the fields of an exec check.
+func schemaLeaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	_, isOneOf := err.ErrorKind.(*kind.OneOf)
+	if !isOneOf {
+		ret := make([]*jsonschema.ValidationError, 0)
+		for _, cause := range err.Causes {
+			ret = append(ret, schemaLeaves(cause)...)
+		}
+		return ret
+	}
+
+	typeLoc := append(slices.Clone(err.InstanceLocation), "type")
+	matching := make([]*jsonschema.ValidationError, 0)
+	wants := make([]any, 0)
+	missing := false
+	for _, cause := range err.Causes {
+		leaves := schemaLeaves(cause)
+
+		mismatch := false
+		for _, leaf := range leaves {
+			switch k := leaf.ErrorKind.(type) {
+			case *kind.Enum:
+				if slices.Equal(leaf.InstanceLocation, typeLoc) {
+					mismatch = true
+					wants = append(wants, k.Want...)
+				}
+			case *kind.Required:
+				if slices.Equal(leaf.InstanceLocation, err.InstanceLocation) &&
+					slices.Contains(k.Missing, "type") {
+					mismatch = true
+					missing = true
+				}
+			}
+		}
+		if !mismatch {
+			matching = append(matching, leaves...)
+		}
+	}
+	if len(matching) != 0 {
+		return matching
+	}
+
+	if missing {
+		return []*jsonschema.ValidationError{{
+			InstanceLocation: err.InstanceLocation,
+			ErrorKind:        &kind.Required{Missing: []string{"type"}},
+		}}
+	}
+	return []*jsonschema.ValidationError{{
+		InstanceLocation: typeLoc,
+		ErrorKind:        &kind.Enum{Want: wants},
+	}}
+}
+
+// checkTemplates checks the fields of the defaults and templates that are
+// not left to the sites using them.
+func (this *validator) checkTemplates(
+	file *validatedFile, defaults, templates any,
+) {
+	fields, _ := defaults.(map[string]any)
+	this.checkFields(file, "/defaults", fields)
+
+	named, _ := templates.(map[string]any)
+	for name, template := range named {
+		fields, _ := template.(map[string]any)
+		this.checkFields(file, JoinPointer("/templates", name), fields)
+	}
+}
+
+// checkSites checks the sites of a file after filling in their defaults
+// and templates, see expandSites.
+func (this *validator) checkSites(file *validatedFile, defaults, templates any) {
+	named, _ := templates.(map[string]any)
+	defaultFields, _ := defaults.(map[string]any)
+
+	for i, s := range asSlice(file.raw["sites"]) {
+		site, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		ptr := JoinPointer("/sites", strconv.Itoa(i))
+		field := func(name string) string { return JoinPointer(ptr, name) }
+
+		expanded := make(map[string]any)
+		fillFields(expanded, site)
+		if name, ok := site["extends"].(string); ok {
+			template, ok := named[name].(map[string]any)
+			if ok {
+				fillFields(expanded, template)
+			} else {
+				this.add(file, field("extends"), fmt.Sprintf("unknown template \"%s\"", name))
+			}
+		}
+		fillFields(expanded, defaultFields)
+
+		if title, ok := expanded["title"].(string); ok {
+			this.checkTitle(file, field("title"), title)
+		}
+		if u, ok := expanded["url"].(string); ok {
+			err := checkUrl(u, []string{"http", "https"})
+			if err != nil {
+				this.add(file, field("url"), fmt.Sprintf("invalid url: %v", err))
+			}
+		}
+
+		this.checkFields(file, ptr, site)
+		interval, intervalOk := parseDuration(expanded["interval"])
+		timeout, timeoutOk := parseDuration(expanded["timeout"])
+		if intervalOk && timeoutOk && timeout > interval {
+			this.add(file, field("timeout"), fmt.Sprintf(
+				"timeout %s is longer than interval %s", timeout, interval,
+			))
+		}
+
+		if check, ok := expanded["check"].(map[string]any); ok {
+			this.checkCheck(file, field("check"), check)
+		}
+	}
+}
+
+// checkDiscovery checks the discovery sources of a file. The sites they
+// list are not loaded, as commands may have side effects.
+func (this *validator) checkDiscovery(file *validatedFile, templates any) {
+	named, _ := templates.(map[string]any)
+
+	for i, d := range asSlice(file.raw["discovery"]) {
+		source, ok := d.(map[string]any)
+		if !ok {
+			continue
+		}
+		ptr := JoinPointer("/discovery", strconv.Itoa(i))
+
+		_, files := source["files"]
+		_, command := source["command"]
+		if files == command {
+			this.add(file, ptr, "exactly one of files and command must be set")
+		}
+		if name, ok := source["extends"].(string); ok {
+			_, ok := named[name]
+			if !ok {
+				this.add(
+					file, JoinPointer(ptr, "extends"),
+					fmt.Sprintf("unknown template \"%s\"", name),
+				)
+			}
+		}
+		if cmd, ok := source["command"].(string); ok {
+			this.checkCommand(file, JoinPointer(ptr, "command"), cmd)
+		}
+
+		this.checkFields(file, ptr, source)
+	}
+}
+
+// CheckTitle checks that a title can name the site's directory under the
+// PID directory of the daemon.
+func CheckTitle(title string) error {
+	switch {
+	case title == "" || title == "." || title == "..":
+		return fmt.Errorf("title \"%s\" cannot name a directory", title)
+	case strings.ContainsAny(title, "/\x00"):
+		return fmt.Errorf(
+			"title \"%s\" cannot name a directory, it contains '/' or NUL", title,
+		)
+	case title == common.CONTROL_SOCKET:
+		return fmt.Errorf("title \"%s\" is reserved", title)
+	}
+	return nil
+}
+
+// checkTitle checks that a title is unique and can name the site's
+// directory.
+func (this *validator) checkTitle(file *validatedFile, ptr string, title string) {
+	err := CheckTitle(title)
+	if err != nil {
+		this.add(file, ptr, err.Error())
+	}
+
+	first, ok := this.titles[title]
+	if ok {
+		this.add(file, ptr, fmt.Sprintf(
+			"duplicate site title \"%s\", first defined at %s:%s",
+			title, first.File, first.Position,
+		))
+		return
+	}
+	this.titles[title] = Problem{File: file.path, Position: file.positions.Find(ptr)}
+}
+
+// checkFields checks the fields a site shares with templates and the
+// defaults, where they are set. Their schema pattern errors are skipped for
+// these clearer messages.
+func (this *validator) checkFields(
+	file *validatedFile, ptr string, fields map[string]any,
+) {
+	for _, name := range []string{"interval", "timeout"} {
+		s, ok := fields[name].(string)
+		if !ok {
+			continue
+		}
+		_, err := time.ParseDuration(s)
+		if err != nil {
+			this.add(file, JoinPointer(ptr, name), err.Error())
+		}
+	}
+
+	if p, ok := fields["proxy"].(string); ok {
+		err := checkUrl(p, []string{"socks5", "http", "https"})
+		if err != nil {
+			this.add(file, JoinPointer(ptr, "proxy"), fmt.Sprintf("invalid proxy: %v", err))
+		}
+	}
+}
+
+var CHECKED_FIELDS = []string{"interval", "timeout", "proxy"}
+
+// parseDuration parses a duration field, which may be unset or invalid.
+func parseDuration(v any) (time.Duration, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil
+}
+
+func (this *validator) checkCheck(
+	file *validatedFile, ptr string, check map[string]any,
+) {
+	switch check["type"] {
+	case "exec":
+		cmd, ok := check["exec"].(string)
+		if ok {
+			this.checkCommand(file, JoinPointer(ptr, "exec"), cmd)
+		}
+	case "shell":
+		shell, ok := check["shell"].(string)
+		if !ok {
+			shell = "/usr/bin/sh"
+		}
+		this.checkExecutable(file, JoinPointer(ptr, "shell"), shell)
+	}
+}
+
+// checkCommand checks that a command run without a shell can be started.
+func (this *validator) checkCommand(file *validatedFile, ptr string, cmd string) {
+	args, err := shlex.Split(cmd)
+	if err != nil || len(args) == 0 {
+		this.add(file, ptr, "invalid command")
+		return
+	}
+	this.checkExecutable(file, ptr, args[0])
+}
+
+func (this *validator) checkExecutable(file *validatedFile, ptr string, binary string) {
+	_, err := exec.LookPath(binary)
+	if err != nil {
+		this.add(file, ptr, fmt.Sprintf("%s is not an executable: %v", binary, err))
+	}
+}
+
+func checkUrl(s string, schemes []string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return errors.Unwrap(err)
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FORMAT_JSON, "{\n  \"sites\": [\n    {\"title\": \"a\",\n     \"url\": \"x\"}\n  ]\n}\n"},
+		{FORMAT_YAML, "sites:\n  - title: a\n    url: x\n"},
+		{FORMAT_TOML, "[[sites]]\ntitle = 'a'\n\n[[sites]]\ntitle = 'b'\nurl = 'x'\n"},
+	}
+	want := map[Format]map[string]Position{
+		FORMAT_JSON: {"/sites": {2, 3}, "/sites/0": {3, 5}, "/sites/0/url": {4, 6}},
+		FORMAT_YAML: {"/sites": {1, 1}, "/sites/0": {2, 5}, "/sites/0/url": {3, 5}},
+		FORMAT_TOML: {"/sites/1": {4, 3}, "/sites/1/title": {5, 1}, "/sites/1/url": {6, 1}},
+	}
+
+	for _, test := range tests {
+		positions, err := Locate(test.format, []byte(test.input))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		for ptr, pos := range want[test.format] {
+			if positions[ptr] != pos {
+				t.Fatalf(
+					"%s: expected %s at %s, got %s",
+					test.format, ptr, pos, positions[ptr],
+				)
+				return
+			}
+		}
+	}
+
+	positions := Positions{"": {1, 1}, "/sites/0": {2, 5}}
+	if positions.Find("/sites/0/check/exec") != (Position{2, 5}) {
+		t.Fatal("expected position of the closest parent")
+		return
+	}
+}
+
+func TestValidate(t *testing.T) {
+	b, err := os.ReadFile("../schema.json")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	SetSchema(b)
+	defer SetSchema(nil)
+
+	schema, err := CompileSchema()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "avail.yaml")
+	err = os.WriteFile(path, []byte(`sites:
+  - title: api
+    url: https://example.com
+    interval: 5s
+    timeout: 10s
+  - title: api
+    url: https://example.com
+    proxy: ftp://localhost
+  - title: ../etc
+    url: https://example.com
+    interval: 5q
+    check: {type: exec, exec: /nonexistent/binary}
+  - title: loop
+    url: https://example.com
+    check: {type: shell, script: 'for i in 1 2; do echo ${i}; done'}
+discovery:
+  - files: found/*.json
+    command: list-sites
+    interval: 1y
+    extends: missing
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	problems, err := Validate(path, schema)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	lines := make([]string, 0)
+	for _, p := range problems {
+		lines = append(lines, strings.TrimPrefix(p.String(), path+":"))
+	}
+	expected := []string{
+		`5:5: timeout 10s is longer than interval 5s`,
+		`6:5: duplicate site title "api", first defined at ` + path + `:2:5`,
+		`8:5: invalid proxy: scheme must be one of socks5, http, https`,
+		`9:5: title "../etc" cannot name a directory`,
+		`11:5: time: unknown unit "q" in duration "5q"`,
+		`12:25: /nonexistent/binary is not an executable`,
+		`17:5: exactly one of files and command must be set`,
+		`18:5: list-sites is not an executable`,
+		`19:5: time: unknown unit "y" in duration "1y"`,
+		`20:5: unknown template "missing"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected problems:\n%s", strings.Join(lines, "\n"))
+		return
+	}
+	for i := range expected {
+		if !strings.HasPrefix(lines[i], expected[i]) {
+			t.Fatalf("expected %q, got %q", expected[i], lines[i])
+			return
+		}
+	}
+}
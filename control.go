@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thekhanj/avail/common"
+)
+
+// Requests are appended, one per line, to a site's request file and picked
+// up by the daemon once it receives SIGUSR1.
+const (
+	REQUEST_CHECK  = "check"
+	REQUEST_PAUSE  = "pause"
+	REQUEST_RESUME = "resume"
+)
+
+// Client talks to a running daemon.
+type Client interface {
+	Titles() ([]string, error)
+	SiteEntry(title string) (SiteEntry, error)
+	SitesStatus(titles []string) (SiteStatusList, error)
+	History(title string) ([]Sample, error)
+	Request(title, request string) error
+	CheckNow(ctx context.Context, title string) (SiteStatus, error)
+	Reload() error
+	Shutdown() error
+}
+
+// Connect returns a client using the control socket of the daemon, or one
+// using the files and signals under its PID directory if the socket is not
+// available. The latter still reads the status of an older daemon, but
+// refuses to send it requests, see SendRequest.
+func Connect(pid int) Client {
+	client, err := DialControl(pid)
+	if err != nil {
+		return NewInfo(pid)
+	}
+
+	return client
+}
+
+var _ Client = (*Info)(nil)
+
+func (this *Info) Request(title, request string) error {
+	return SendRequest(this.pid, title, request)
+}
+
+// CheckNow sends a check request and waits for the site's latency file to
+// be replaced, which happens after each check. Unlike through the control
+// socket, this may return the result of a scheduled check that was already
+// running.
+func (this *Info) CheckNow(ctx context.Context, title string) (SiteStatus, error) {
+	latency := filepath.Join(common.GetPidVarDir(this.pid), title, "latency")
+
+	before, err := os.Stat(latency)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return SiteStatus{}, err
+	}
+
+	err = this.Request(title, REQUEST_CHECK)
+	if err != nil {
+		return SiteStatus{}, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return SiteStatus{}, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		after, err := os.Stat(latency)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return SiteStatus{}, err
+		}
+		if before == nil || !os.SameFile(before, after) {
+			return this.SiteStatus(title)
+		}
+	}
+}
+
+// Reload signals the daemon to reload its config. Unlike through the
+// control socket, errors are only reported in the daemon's log.
+func (this *Info) Reload() error {
+	return this.signal(RELOAD_SIGNAL)
+}
+
+func (this *Info) Shutdown() error {
+	return this.signal(syscall.SIGTERM)
+}
+
+func (this *Info) signal(sig os.Signal) error {
+	proc, err := os.FindProcess(this.pid)
+	if err != nil {
+		return err
+	}
+
+	return proc.Signal(sig)
+}
+
+// SendRequest appends a request to the site's request file and signals the
+// daemon. The daemon keeps the file around while it runs the site, so a
+// missing one means a daemon that would be killed by the signal.
+func SendRequest(pid int, title, request string) error {
+	return SendRequestPath(
+		filepath.Join(common.GetPidVarDir(pid), title), pid, request,
+	)
+}
+
+// SendRequestPath is like SendRequest, for the site whose files are in dir.
+func SendRequestPath(dir string, pid int, request string) error {
+	_, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("site not found: %s", filepath.Base(dir))
+	}
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "request")
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(
+			"daemon %d is too old to receive requests, restart it", pid,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(request + "\n")
+	if err != nil {
+		return err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return proc.Signal(REQUEST_SIGNAL)
+}
+
+// CreateRequestFile creates the empty request file of a site, unless a
+// request was already appended to it.
+func CreateRequestFile(dir string) error {
+	file, err := os.OpenFile(
+		filepath.Join(dir, "request"), os.O_CREATE|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ReadRequests atomically takes the pending requests of a site out of its
+// request file, leaving an empty one.
+func ReadRequests(dir string) ([]string, error) {
+	path := filepath.Join(dir, "request")
+	taken := path + ".taken"
+
+	err := os.Rename(path, taken)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, CreateRequestFile(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(taken)
+
+	err = CreateRequestFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(taken)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0)
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			ret = append(ret, line)
+		}
+	}
+
+	return ret, nil
+}
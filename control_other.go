@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+// REQUEST_SIGNAL cannot be sent on other platforms, where requests only
+// reach the daemon through its control socket.
+const REQUEST_SIGNAL = syscall.Signal(0x1e)
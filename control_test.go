@@ -0,0 +1,66 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendRequest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "requested")
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	// a daemon without request files would be killed by the signal
+	err = SendRequestPath(dir, os.Getpid(), REQUEST_CHECK)
+	if err == nil || !strings.Contains(err.Error(), "too old") {
+		t.Fatalf("expected an old daemon to be refused, got %v", err)
+		return
+	}
+
+	err = CreateRequestFile(dir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, REQUEST_SIGNAL)
+	defer signal.Stop(signals)
+
+	err = SendRequestPath(dir, os.Getpid(), REQUEST_CHECK)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	select {
+	case <-signals:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the daemon to be signalled")
+		return
+	}
+
+	requests, err := ReadRequests(dir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !slices.Equal(requests, []string{REQUEST_CHECK}) {
+		t.Fatalf("unexpected requests: %v", requests)
+		return
+	}
+	_, err = os.Stat(filepath.Join(dir, "request"))
+	if err != nil {
+		t.Fatal("expected the request file to be kept")
+		return
+	}
+}
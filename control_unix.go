@@ -0,0 +1,7 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+const REQUEST_SIGNAL = syscall.SIGUSR1
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/thekhanj/avail/common"
 	"github.com/thekhanj/avail/config"
@@ -15,15 +20,56 @@ import (
 
 type DaemonOption = func(ping *Daemon)
 
+// RELOAD_SIGNAL makes the daemon re-read its config file.
+const RELOAD_SIGNAL = syscall.SIGHUP
+
 type Daemon struct {
-	cfg *config.Config
-	log *log.Logger
+	cfg     *config.Config
+	cfgPath string
+	pidFile string
+	// holds a directory per site, the PID directory unless set otherwise
+	pidDir string
+	log    *slog.Logger
+
+	// log the result of each check at the debug level
+	transitionsOnly bool
+
+	notifier    *Notifier
+	listenFiles map[string]*os.File
+
+	// guards the state below, which changes on reloads
+	mu    sync.Mutex
+	sites map[string]*daemonSite
+	// configs of the running sites, those of the config followed by the
+	// discovered ones
+	siteCfgs     []config.Ping
+	wg           sync.WaitGroup
+	serverCfg    *config.StatusPage
+	serverCancel context.CancelFunc
+
+	// states of the previous daemon, not restored yet
+	restored map[string]PingState
+
+	// sites found by each discovery source of the config
+	discovered      [][]config.Ping
+	discoveryCancel context.CancelFunc
+}
+
+// daemonSite is a running ping along with the config it was created from.
+type daemonSite struct {
+	cfg    config.Ping
+	ping   *Ping
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func NewDaemon(cfg *config.Config, opts ...DaemonOption) *Daemon {
 	base := &Daemon{
-		cfg: cfg,
-		log: log.New(os.Stderr, "daemon: ", 0),
+		cfg:             cfg,
+		pidDir:          common.GetPidVarDir(syscall.Getpid()),
+		log:             slog.Default().With("component", "daemon"),
+		sites:           make(map[string]*daemonSite),
+		transitionsOnly: cfg.GetLog().TransitionsOnly,
 	}
 
 	for _, o := range opts {
@@ -33,59 +79,586 @@ func NewDaemon(cfg *config.Config, opts ...DaemonOption) *Daemon {
 	return base
 }
 
-func DaemonWithLog(log *log.Logger) DaemonOption {
+func DaemonWithLog(log *slog.Logger) DaemonOption {
 	return func(d *Daemon) {
 		d.log = log
 	}
 }
 
+// DaemonWithConfigPath sets the file the config is re-read from on reloads.
+func DaemonWithConfigPath(path string) DaemonOption {
+	return func(d *Daemon) {
+		d.cfgPath = path
+	}
+}
+
+// DaemonWithPidDir sets the directory the sites' files are written to.
+func DaemonWithPidDir(dir string) DaemonOption {
+	return func(d *Daemon) {
+		d.pidDir = dir
+	}
+}
+
+// DaemonWithNotifier makes the daemon report its state to systemd.
+func DaemonWithNotifier(notifier *Notifier) DaemonOption {
+	return func(d *Daemon) {
+		d.notifier = notifier
+	}
+}
+
+// DaemonWithListenFiles sets the sockets passed by socket activation. The
+// status page uses the one named "status", or the only one passed.
+func DaemonWithListenFiles(files map[string]*os.File) DaemonOption {
+	return func(d *Daemon) {
+		d.listenFiles = files
+	}
+}
+
 func (this *Daemon) Run(ctx context.Context) error {
-	err := this.writePid()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	this.pidFile = this.cfg.GetPidFile()
+
+	runDir, err := LockRunDir(this.cfg.GetRunDir())
+	if err != nil {
+		return err
+	}
+	defer runDir.Close()
+
+	err = this.writePid()
 	if err != nil {
 		return err
 	}
 	defer this.cleanup()
 
-	pings := make([]*Ping, len(this.cfg.Sites))
-	for i, pingCfg := range this.cfg.Sites {
-		ping, err := NewPingFromConfig(&pingCfg)
+	err = os.MkdirAll(this.pidDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = runDir.Link(this.pidDir)
+	if err != nil {
+		return err
+	}
+
+	state, err := ReadStateFile(this.cfg.GetStateFile())
+	if err != nil {
+		this.log.Warn("reading state failed", "error", err)
+	} else {
+		this.restored = state.Sites
+	}
+
+	// subscribe before starting anything, SIGHUP would terminate us otherwise
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, REQUEST_SIGNAL, RELOAD_SIGNAL)
+	defer signal.Stop(signals)
+
+	// before the sites create their files, see listenPrivate
+	this.runControl(ctx, cancel)
+
+	err = this.apply(ctx, this.cfg)
+	if err != nil {
+		cancel()
+		this.wg.Wait()
+		return err
+	}
+
+	go this.handleSignals(ctx, signals)
+
+	if len(this.listenFiles) != 0 && this.cfg.StatusPage == nil {
+		this.log.Warn("socket activation requires statusPage")
+	}
+
+	this.notify("READY=1", "STATUS="+statusSummary(this.Pings()))
+	go this.runNotifier(ctx)
+
+	<-ctx.Done()
+	this.notify("STOPPING=1")
+
+	this.wg.Wait()
+	this.saveState()
+	return nil
+}
+
+// Reload re-reads the config file and applies it. Sites whose config did
+// not change keep running untouched. If the new config is invalid, it is
+// rejected and the current one keeps running.
+func (this *Daemon) Reload(ctx context.Context) error {
+	if this.cfgPath == "" {
+		return errors.New("reload is not supported without a config file")
+	}
+
+	cfg, err := config.ReadConfig(this.cfgPath)
+	if err != nil {
+		return fmt.Errorf("reload rejected: %w", err)
+	}
+
+	err = this.apply(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("reload rejected: %w", err)
+	}
+
+	this.log.Info("config reloaded")
+	return nil
+}
+
+// apply starts added sites, stops removed ones and restarts the changed
+// ones. The discovery sources are loaded again first. All new pings are
+// created before touching the running ones, so an invalid config leaves
+// the daemon as it was.
+func (this *Daemon) apply(ctx context.Context, cfg *config.Config) error {
+	discoveries, discovered, err := this.discover(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	stopped, err := this.applySites(ctx, cfg.Sites, discovered)
+	if err != nil {
+		this.mu.Unlock()
+		return err
+	}
+
+	if this.pidFile != cfg.GetPidFile() {
+		this.log.Warn("changing pidFile requires a restart")
+	}
+	if this.cfg.GetRunDir() != cfg.GetRunDir() {
+		this.log.Warn("changing runDir requires a restart")
+	}
+	if !reflect.DeepEqual(this.cfg.GetLog(), cfg.GetLog()) {
+		this.log.Warn("changing log requires a restart")
+	}
+
+	this.cfg = cfg
+	this.applyServer(ctx, cfg.StatusPage)
+	this.startDiscovery(ctx, discoveries, discovered)
+	this.mu.Unlock()
+
+	waitStopped(stopped)
+	return nil
+}
+
+// applySites runs the given sites, followed by the discovered ones. A
+// discovered site that is invalid or whose title is taken is skipped, so
+// that a source cannot break the daemon. The removed and changed sites are
+// stopped without waiting for a running check under the lock, and a
+// changed site only starts again after its previous run exited. Returns
+// the channels closed once the stopped sites have exited. Must be called
+// with the lock held.
+func (this *Daemon) applySites(
+	ctx context.Context, sites []config.Ping, discovered [][]config.Ping,
+) ([]<-chan struct{}, error) {
+	wanted := make(map[string]bool)
+	created := make(map[string]*Ping)
+	siteCfgs := make([]config.Ping, 0, len(sites))
+	add := func(pingCfg config.Ping) error {
+		old, ok := this.sites[pingCfg.Title]
+		if !ok || !reflect.DeepEqual(old.cfg, pingCfg) {
+			ping, err := NewPingFromConfig(
+				&pingCfg,
+				PingWithPath(filepath.Join(this.pidDir, pingCfg.Title)),
+				PingWithTransitionsOnly(this.transitionsOnly),
+			)
+			if err != nil {
+				return fmt.Errorf("%s: %w", pingCfg.Title, err)
+			}
+			created[pingCfg.Title] = ping
+		}
+
+		wanted[pingCfg.Title] = true
+		siteCfgs = append(siteCfgs, pingCfg)
+		return nil
+	}
+
+	for _, pingCfg := range sites {
+		if wanted[pingCfg.Title] {
+			return nil, fmt.Errorf("duplicate site title: %s", pingCfg.Title)
+		}
+		err := add(pingCfg)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+	for i, found := range discovered {
+		for _, pingCfg := range found {
+			if wanted[pingCfg.Title] {
+				this.log.Warn(
+					"discovered site skipped, its title is taken",
+					"discovery", i, "site", pingCfg.Title,
+				)
+				continue
+			}
+			err := add(pingCfg)
+			if err != nil {
+				this.log.Warn(
+					"discovered site skipped", "discovery", i, "error", err,
+				)
+			}
 		}
-		pings[i] = ping
 	}
 
-	this.runPings(ctx, pings)
-	return nil
+	// each state continues the first site of its title, which may only be
+	// added by a later reload or discovery
+	for title, ping := range created {
+		state, ok := this.restored[title]
+		if ok {
+			ping.Restore(state)
+			delete(this.restored, title)
+		}
+	}
+
+	stopped := make([]<-chan struct{}, 0)
+	previous := make(map[string]<-chan struct{})
+	for title, site := range this.sites {
+		_, changed := created[title]
+		if wanted[title] && !changed {
+			continue
+		}
+
+		site.cancel()
+		stopped = append(stopped, site.done)
+		previous[title] = site.done
+		delete(this.sites, title)
+	}
+
+	for _, pingCfg := range siteCfgs {
+		ping, ok := created[pingCfg.Title]
+		if !ok {
+			continue
+		}
+
+		this.startSite(ctx, pingCfg, ping, previous[pingCfg.Title])
+	}
+
+	this.siteCfgs = siteCfgs
+	return stopped, nil
 }
 
-func (this *Daemon) runPings(ctx context.Context, pings []*Ping) {
-	var wg sync.WaitGroup
+func waitStopped(stopped []<-chan struct{}) {
+	for _, done := range stopped {
+		<-done
+	}
+}
 
-	wg.Add(len(pings))
-	for _, ping := range pings {
+// discover loads each discovery source of the config once. A source that
+// fails keeps the sites it found before, if its config did not change.
+func (this *Daemon) discover(
+	ctx context.Context, cfg *config.Config,
+) ([]*Discovery, [][]config.Ping, error) {
+	this.mu.Lock()
+	previous, previousCfg := this.discovered, this.cfg
+	this.mu.Unlock()
+
+	discoveries := make([]*Discovery, len(cfg.Discovery))
+	discovered := make([][]config.Ping, len(cfg.Discovery))
+	for i, source := range cfg.Discovery {
+		d, err := NewDiscovery(cfg, this.cfgPath, source, this.log)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovery %d: %w", i, err)
+		}
+		discoveries[i] = d
+
+		sites, err := d.Load(ctx)
+		if err == nil {
+			discovered[i] = sites
+			continue
+		}
+
+		d.log.Warn("discovery failed", "error", config.Redact(err.Error()))
+		if i < len(previous) && reflect.DeepEqual(previousCfg.Discovery[i], source) {
+			discovered[i] = previous[i]
+		}
+	}
+
+	return discoveries, discovered, nil
+}
+
+// startDiscovery replaces the running discovery sources. Must be called
+// with the lock held.
+func (this *Daemon) startDiscovery(
+	ctx context.Context, discoveries []*Discovery, discovered [][]config.Ping,
+) {
+	if this.discoveryCancel != nil {
+		this.discoveryCancel()
+		this.discoveryCancel = nil
+	}
+	this.discovered = discovered
+
+	if len(discoveries) == 0 {
+		return
+	}
+
+	discoveryCtx, cancel := context.WithCancel(ctx)
+	this.discoveryCancel = cancel
+
+	for i, d := range discoveries {
+		this.wg.Add(1)
 		go func() {
-			defer wg.Done()
+			defer this.wg.Done()
 
-			ping.Run(ctx)
+			d.Run(discoveryCtx, func(sites []config.Ping) {
+				this.updateDiscovered(ctx, discoveryCtx, i, sites)
+			})
 		}()
 	}
-	wg.Wait()
+}
+
+// updateDiscovered runs the sites a discovery source found, unless a reload
+// replaced the source meanwhile.
+func (this *Daemon) updateDiscovered(
+	ctx, discoveryCtx context.Context, i int, sites []config.Ping,
+) {
+	this.mu.Lock()
+	if discoveryCtx.Err() != nil || reflect.DeepEqual(this.discovered[i], sites) {
+		this.mu.Unlock()
+		return
+	}
+	this.discovered[i] = sites
+
+	stopped, err := this.applySites(ctx, this.cfg.Sites, this.discovered)
+	this.mu.Unlock()
+	if err != nil {
+		this.log.Error("applying discovered sites failed", "error", err)
+		return
+	}
+	this.log.Info("discovered sites changed", "discovery", i, "sites", len(sites))
+
+	waitStopped(stopped)
+}
+
+// startSite runs the ping once previous, the run of the site it replaces,
+// is done. previous is nil for a new site.
+func (this *Daemon) startSite(
+	ctx context.Context, cfg config.Ping, ping *Ping, previous <-chan struct{},
+) {
+	ctx, cancel := context.WithCancel(ctx)
+	site := &daemonSite{
+		cfg:    cfg,
+		ping:   ping,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	this.sites[cfg.Title] = site
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		defer close(site.done)
+
+		// both would use the site's directory
+		if previous != nil {
+			<-previous
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		ping.Run(ctx)
+	}()
+}
+
+// applyServer (re)starts the status page server if its config changed.
+func (this *Daemon) applyServer(ctx context.Context, cfg *config.StatusPage) {
+	if reflect.DeepEqual(this.serverCfg, cfg) && this.serverCancel != nil {
+		return
+	}
+
+	if this.serverCancel != nil {
+		this.serverCancel()
+		this.serverCancel = nil
+	}
+	this.serverCfg = cfg
+
+	if cfg == nil {
+		return
+	}
+
+	server, err := NewServer(cfg, this)
+	if err != nil {
+		this.log.Error("creating status page failed", "error", err)
+		return
+	}
+
+	l, err := this.listen("status", cfg.Listen)
+	if err != nil {
+		this.log.Error("serving status page failed", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	this.serverCancel = cancel
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+
+		err := server.Serve(ctx, l)
+		if err != nil {
+			this.log.Error("serving status page failed", "error", err)
+		}
+	}()
+}
+
+// listen returns the socket-activated listener with the given name, or the
+// only one passed. Otherwise it listens on addr.
+func (this *Daemon) listen(name, addr string) (net.Listener, error) {
+	f, ok := this.listenFiles[name]
+	if !ok && len(this.listenFiles) == 1 {
+		for _, file := range this.listenFiles {
+			f, ok = file, true
+		}
+	}
+
+	if ok {
+		// a duplicate, as the server closes it when restarted by a reload
+		return net.FileListener(f)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// runControl serves the control socket, falling back to files and signals
+// only if it cannot be created.
+func (this *Daemon) runControl(ctx context.Context, shutdown context.CancelFunc) {
+	server := NewControlServer(this, shutdown)
+
+	l, err := ListenControl(filepath.Join(this.pidDir, common.CONTROL_SOCKET))
+	if err != nil {
+		this.log.Warn("control socket unavailable", "error", err)
+		return
+	}
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+
+		err := server.Serve(ctx, l)
+		if err != nil {
+			this.log.Warn("control socket unavailable", "error", err)
+		}
+	}()
+}
+
+// Pings returns the running pings, in the order of the config.
+func (this *Daemon) Pings() []*Ping {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ret := make([]*Ping, 0, len(this.sites))
+	for _, pingCfg := range this.siteCfgs {
+		site, ok := this.sites[pingCfg.Title]
+		if ok {
+			ret = append(ret, site.ping)
+		}
+	}
+
+	return ret
+}
+
+var _ SiteSource = (*Daemon)(nil)
+
+func (this *Daemon) notify(assignments ...string) {
+	if this.notifier == nil {
+		return
+	}
+
+	err := this.notifier.Notify(assignments...)
+	if err != nil {
+		this.log.Warn("notifying systemd failed", "error", err)
+	}
+}
+
+// runNotifier keeps the status shown by systemd up to date and pings its
+// watchdog as long as every site keeps being checked, so that a stuck
+// daemon is restarted.
+func (this *Daemon) runNotifier(ctx context.Context) {
+	if this.notifier == nil {
+		return
+	}
+
+	interval := STATUS_INTERVAL
+	watchdog := this.notifier.Watchdog()
+	if watchdog != 0 {
+		interval = min(interval, watchdog/2)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pings := this.Pings()
+			assignments := []string{"STATUS=" + statusSummary(pings)}
+			if watchdog != 0 && this.alive(pings) {
+				assignments = append(assignments, "WATCHDOG=1")
+			}
+			this.notify(assignments...)
+		}
+	}
+}
+
+func (this *Daemon) alive(pings []*Ping) bool {
+	now := time.Now()
+	for _, ping := range pings {
+		if !ping.Alive(now) {
+			this.log.Warn("site is stuck, not pinging the watchdog", "site", ping.Title())
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Daemon) handleSignals(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			switch sig {
+			case REQUEST_SIGNAL:
+				for _, ping := range this.Pings() {
+					ping.HandleRequests()
+				}
+			case RELOAD_SIGNAL:
+				err := this.Reload(ctx)
+				if err != nil {
+					this.log.Error("reload failed", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// saveState persists the state of the sites for the next daemon.
+func (this *Daemon) saveState() {
+	state := &StateFile{
+		Saved: time.Now(),
+		Sites: make(map[string]PingState),
+	}
+	for _, ping := range this.Pings() {
+		state.Sites[ping.Title()] = ping.State()
+	}
+
+	err := WriteStateFile(this.cfg.GetStateFile(), state)
+	if err != nil {
+		this.log.Warn("saving state failed", "error", err)
+	}
 }
 
 func (this *Daemon) cleanup() {
-	err := os.Remove(this.cfg.GetPidFile())
+	err := os.Remove(this.pidFile)
 	if err != nil {
-		this.log.Println(err)
+		this.log.Warn("removing PID file failed", "error", err)
 	}
-	err = os.Remove(common.GetPidVarDir(syscall.Getpid()))
+	err = os.Remove(this.pidDir)
 	if err != nil {
-		this.log.Println(err)
+		this.log.Warn("removing PID directory failed", "error", err)
 	}
 }
 
 func (this *Daemon) writePid() error {
-	pidFile := this.cfg.GetPidFile()
+	pidFile := this.pidFile
 
 	stat, err := os.Stat(pidFile)
 	if err == nil {
@@ -93,7 +666,7 @@ func (this *Daemon) writePid() error {
 			return fmt.Errorf("PID file already exists and is a directory: %s", pidFile)
 		}
 
-		this.log.Printf("warning: PID file already exists: %s\n", pidFile)
+		this.log.Warn("PID file already exists", "path", pidFile)
 
 		pid, err := common.GetPid(pidFile)
 		if err != nil {
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestDaemonApply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	site := func(title, interval string) config.Ping {
+		return config.Ping{
+			Title:    title,
+			Url:      srv.URL,
+			Interval: config.Duration(interval),
+			Timeout:  "1s",
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	d := NewDaemon(&config.Config{
+		Sites: []config.Ping{site("a", "1s"), site("b", "1s"), site("c", "1s")},
+	}, DaemonWithPidDir(t.TempDir()))
+	err := d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	before := d.Pings()
+
+	err = d.apply(ctx, &config.Config{
+		Sites: []config.Ping{site("b", "1s"), site("a", "1s"), site("a", "1s")},
+	})
+	if err == nil {
+		t.Fatal("expected duplicate titles to be rejected")
+		return
+	}
+	if len(d.Pings()) != 3 {
+		t.Fatal("rejected config must keep the old one running")
+		return
+	}
+
+	err = d.apply(ctx, &config.Config{
+		Sites: []config.Ping{site("a", "1s"), site("b", "2s"), site("d", "1s")},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	after := d.Pings()
+
+	if len(after) != 3 || after[0].Title() != "a" ||
+		after[1].Title() != "b" || after[2].Title() != "d" {
+		t.Fatalf("unexpected sites after reload: %v", after)
+		return
+	}
+	if after[0] != before[0] {
+		t.Fatal("untouched site must not be restarted")
+		return
+	}
+	if after[1] == before[1] {
+		t.Fatal("changed site must be restarted")
+		return
+	}
+
+	cancel()
+	d.wg.Wait()
+}
+
+// blockingCheck never returns until released, like a stuck check script.
+type blockingCheck struct {
+	release chan struct{}
+	// optionally signalled when a check starts
+	called chan struct{}
+}
+
+func (this *blockingCheck) IsUp(res *http.Response) (bool, error) {
+	select {
+	case this.called <- struct{}{}:
+	default:
+	}
+	<-this.release
+	return true, nil
+}
+
+func TestDaemonApplyStuckSite(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	dir := t.TempDir()
+	check := &blockingCheck{
+		release: make(chan struct{}), called: make(chan struct{}, 1),
+	}
+	stuck, err := NewPing(
+		"a", srv.URL, PingWithPath(filepath.Join(dir, "a")), PingWithCheck(check),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	cfg := config.Ping{Title: "a", Url: srv.URL, Interval: "1h", Timeout: "1s"}
+	d := NewDaemon(
+		&config.Config{Sites: []config.Ping{cfg}}, DaemonWithPidDir(dir),
+	)
+	d.mu.Lock()
+	d.startSite(ctx, cfg, stuck, nil)
+	d.mu.Unlock()
+	<-check.called
+
+	applied := make(chan error, 1)
+	go func() {
+		cfg := cfg
+		cfg.Interval = "2h"
+		applied <- d.apply(ctx, &config.Config{Sites: []config.Ping{cfg}})
+	}()
+
+	var replacement *Ping
+	for replacement == nil {
+		pings := make(chan []*Ping, 1)
+		go func() { pings <- d.Pings() }()
+		select {
+		case p := <-pings:
+			if len(p) == 1 && p[0] != stuck {
+				replacement = p[0]
+			}
+		case <-time.After(time.Second):
+			t.Fatal("a stuck site must not block the daemon during a reload")
+			return
+		}
+	}
+
+	select {
+	case <-applied:
+		t.Fatal("apply must wait for the stopped sites")
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	if replacement.Status().State != STATE_UNKNOWN {
+		t.Fatal("the replacement must wait for the stuck site to exit")
+		return
+	}
+
+	close(check.release)
+	err = <-applied
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	cancel()
+	d.wg.Wait()
+}
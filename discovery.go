@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+	"github.com/thekhanj/avail/exec"
+)
+
+// Discovery loads the sites of a discovery source of the config,
+// periodically.
+type Discovery struct {
+	cfg      *config.Config
+	cfgPath  string
+	source   config.Discovery
+	interval time.Duration
+	log      *slog.Logger
+}
+
+// NewDiscovery creates a discovery source of cfg, read from cfgPath. Files
+// patterns are relative to cfgPath.
+func NewDiscovery(
+	cfg *config.Config, cfgPath string, source config.Discovery,
+	log *slog.Logger,
+) (*Discovery, error) {
+	interval, err := time.ParseDuration(string(source.Interval))
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid discovery interval: %s", source.Interval)
+	}
+
+	return &Discovery{
+		cfg:      cfg,
+		cfgPath:  cfgPath,
+		source:   source,
+		interval: interval,
+		log:      log.With("source", source.String()),
+	}, nil
+}
+
+// Load lists the sites of the source once. A command has one interval to
+// list them.
+func (this *Discovery) Load(ctx context.Context) ([]config.Ping, error) {
+	if this.source.Command != nil {
+		return this.loadCommand(ctx, *this.source.Command)
+	}
+
+	files, err := config.DiscoveryFiles(this.cfgPath, &this.source)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]config.Ping, 0)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sites, err := this.cfg.ParseDiscovered(file, b, &this.source)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, sites...)
+	}
+	return ret, nil
+}
+
+func (this *Discovery) loadCommand(ctx context.Context, command string) ([]config.Ping, error) {
+	ctx, cancel := context.WithTimeout(ctx, this.interval)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	opts := []exec.Option{
+		exec.WithShlex(command),
+		exec.WithStdout(&stdout),
+		exec.WithLogger(
+			slog.NewLogLogger(this.log.Handler(), slog.LevelWarn),
+		),
+	}
+	for _, env := range os.Environ() {
+		opts = append(opts, exec.WithEnv(env))
+	}
+
+	e, err := exec.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = e.RunContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("running discovery command: %w", err)
+	}
+
+	return this.cfg.ParseDiscovered("", stdout.Bytes(), &this.source)
+}
+
+// Run loads the sites every interval and reports them to found. A failed
+// load is logged and keeps the previous sites.
+func (this *Discovery) Run(ctx context.Context, found func(sites []config.Ping)) {
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sites, err := this.Load(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					this.log.Warn("discovery failed", "error", config.Redact(err.Error()))
+				}
+				continue
+			}
+			found(sites)
+		}
+	}
+}
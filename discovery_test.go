@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestDaemonDiscovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("found/x.yaml", fmt.Sprintf(
+		"- {title: x, url: '%s'}\n- {title: a, url: '%s'}\n", srv.URL, srv.URL,
+	))
+	write("listed.json", fmt.Sprintf(
+		`{"sites": [{"title": "z", "url": "%s", "interval": "2s"}]}`, srv.URL,
+	))
+
+	files := "found/*.yaml"
+	command := "cat " + filepath.Join(dir, "listed.json")
+	fast := "fast"
+	interval := config.Duration("1s")
+	cfg := &config.Config{
+		Sites: []config.Ping{
+			{Title: "a", Url: srv.URL, Interval: "1s", Timeout: "1s"},
+		},
+		Templates: config.ConfigTemplates{
+			"fast": {Interval: &interval, Timeout: &interval},
+		},
+		Discovery: []config.Discovery{
+			{Files: &files, Extends: &fast, Interval: "100ms"},
+			{Command: &command, Extends: &fast, Interval: "100ms"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	d := NewDaemon(
+		cfg, DaemonWithConfigPath(filepath.Join(dir, "avail.json")),
+		DaemonWithPidDir(t.TempDir()),
+	)
+	err := d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	titles := func() []string {
+		ret := make([]string, 0)
+		for _, p := range d.Pings() {
+			ret = append(ret, p.Title())
+		}
+		return ret
+	}
+	if !slices.Equal(titles(), []string{"a", "x", "z"}) {
+		t.Fatalf("unexpected sites: %v", titles())
+		return
+	}
+
+	d.mu.Lock()
+	x, z := d.siteCfgs[1], d.siteCfgs[2]
+	d.mu.Unlock()
+	if x.Interval != "1s" || z.Interval != "2s" || z.Timeout != "1s" {
+		t.Fatalf("template not applied: %+v, %+v", x, z)
+		return
+	}
+	before := d.Pings()
+
+	write("found/x.yaml", fmt.Sprintf("- {title: y, url: '%s'}\n", srv.URL))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(titles(), []string{"a", "y", "z"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("discovered sites not updated: %v", titles())
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	after := d.Pings()
+	if after[0] != before[0] || after[2] != before[2] {
+		t.Fatal("untouched sites must not be restarted")
+		return
+	}
+
+	cancel()
+	d.wg.Wait()
+}
+
+func TestParseDiscovered(t *testing.T) {
+	cfg := &config.Config{}
+
+	for _, b := range []string{
+		`[{"title": "a", "url": "https://a.example.com"}]`,
+		"sites:\n  - {title: a, url: 'https://a.example.com'}\n",
+		"[[sites]]\ntitle = 'a'\nurl = 'https://a.example.com'\n",
+	} {
+		sites, err := cfg.ParseDiscovered("", []byte(b), &config.Discovery{})
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if len(sites) != 1 || sites[0].Title != "a" || sites[0].Interval != "5s" {
+			t.Fatalf("unexpected sites: %+v", sites)
+			return
+		}
+	}
+
+	_, err := cfg.ParseDiscovered(
+		"", []byte(`{"sites": [], "pidFile": "/tmp/x"}`), &config.Discovery{},
+	)
+	if err == nil {
+		t.Fatal("expected fields other than sites to be rejected")
+		return
+	}
+
+	for _, title := range []string{"../../x", "a/b", "..", ".", "a\u0000b"} {
+		_, err = cfg.ParseDiscovered("", []byte(
+			`[{"title": "`+title+`", "url": "https://a.example.com"}]`,
+		), &config.Discovery{})
+		if err == nil {
+			t.Fatalf("expected title %q to be rejected", title)
+			return
+		}
+	}
+}
+
+func TestDaemonRestoreDiscovered(t *testing.T) {
+	dir := t.TempDir()
+	files := "found/*.yaml"
+	cfg := &config.Config{
+		Discovery: []config.Discovery{{Files: &files, Interval: "100ms"}},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	d := NewDaemon(
+		cfg, DaemonWithConfigPath(filepath.Join(dir, "avail.json")),
+		DaemonWithPidDir(t.TempDir()),
+	)
+	d.restored = map[string]PingState{
+		"b": {Url: "http://127.0.0.1:1", Paused: true},
+	}
+	err := d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(d.Pings()) != 0 {
+		t.Fatal("expected no site before the source finds one")
+		return
+	}
+
+	// b is only found after startup
+	err = os.MkdirAll(filepath.Join(dir, "found"), 0755)
+	if err == nil {
+		err = os.WriteFile(
+			filepath.Join(dir, "found", "b.yaml"),
+			[]byte("- {title: b, url: 'http://127.0.0.1:1', interval: 1h}\n"), 0644,
+		)
+	}
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(d.Pings()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("discovered site not started")
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if d.Pings()[0].Status().State != STATE_PAUSED {
+		t.Fatal("expected the state of a site discovered later to be restored")
+		return
+	}
+
+	cancel()
+	d.wg.Wait()
+}
@@ -22,6 +22,15 @@ func WithStdin(stdin io.Reader) Option {
 	}
 }
 
+// WithStdout writes the output of the command to stdout instead of the
+// logger.
+func WithStdout(stdout io.Writer) Option {
+	return func(e *Exec) error {
+		e.stdout = stdout
+		return nil
+	}
+}
+
 func WithEnv(env string) Option {
 	return func(e *Exec) error {
 		e.env = append(e.env, env)
@@ -68,6 +77,7 @@ func New(opts ...Option) (*Exec, error) {
 		env:     []string{},
 		log:     nil,
 		stdin:   nil,
+		stdout:  nil,
 	}
 
 	var err error
@@ -91,6 +101,7 @@ type Exec struct {
 	env     []string
 	log     *log.Logger
 	stdin   io.Reader
+	stdout  io.Writer
 }
 
 func (this *Exec) RunContext(ctx context.Context) (int, error) {
@@ -120,15 +131,21 @@ func (this *Exec) run(cmd *exec.Cmd) (int, error) {
 		}()
 	}
 
+	cmd.Stdout = this.stdout
+
 	if this.log == nil {
 		err := cmd.Start()
 		if err != nil {
 			return 0, err
 		}
 	} else {
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			return 0, err
+		var stdout io.ReadCloser
+		if this.stdout == nil {
+			var err error
+			stdout, err = cmd.StdoutPipe()
+			if err != nil {
+				return 0, err
+			}
 		}
 		stderr, err := cmd.StderrPipe()
 		if err != nil {
@@ -141,7 +158,9 @@ func (this *Exec) run(cmd *exec.Cmd) (int, error) {
 		}
 
 		go this.flush("stderr", stderr)
-		go this.flush("stdout", stdout)
+		if stdout != nil {
+			go this.flush("stdout", stdout)
+		}
 	}
 
 	err := cmd.Wait()
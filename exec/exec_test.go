@@ -1,6 +1,7 @@
 package exec
 
 import (
+	"bytes"
 	"log"
 	"os"
 	"testing"
@@ -22,3 +23,26 @@ func TestExec(t *testing.T) {
 		return
 	}
 }
+
+func TestExecStdout(t *testing.T) {
+	var stdout bytes.Buffer
+	e, err := New(
+		WithLogger(log.New(os.Stderr, "log-prefix", 0)),
+		WithShlex(`/usr/bin/sh -c 'echo hello; echo oops >&2'`),
+		WithStdout(&stdout),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	_, err = e.Run()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if stdout.String() != "hello\n" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+		return
+	}
+}
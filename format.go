@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Record is a single row of tabular output. Columns must match the header
+// passed to Write.
+type Record interface {
+	Row() []string
+}
+
+type OutputFlags struct {
+	format   string
+	template string
+}
+
+func (this *OutputFlags) SetFlags(f *flag.FlagSet) {
+	f.StringVar(
+		&this.format, "format", "text",
+		"output format (text, json, yaml, csv, tsv)",
+	)
+	f.StringVar(
+		&this.template, "template", "",
+		"go template applied to each site, e.g. '{{.Title}} {{.Latency}}'",
+	)
+}
+
+func (this *OutputFlags) Validate() error {
+	switch this.format {
+	case "text", "json", "yaml", "csv", "tsv":
+	default:
+		return fmt.Errorf("invalid output format \"%s\"", this.format)
+	}
+
+	if this.template != "" && this.format != "text" {
+		return fmt.Errorf("-template cannot be combined with -format %s", this.format)
+	}
+
+	return nil
+}
+
+func (this *OutputFlags) IsText() bool {
+	return this.format == "text" && this.template == ""
+}
+
+// Write encodes records in the requested format. Text output is left to the
+// caller as every command has its own human readable layout.
+func Write[T Record](
+	w io.Writer, this *OutputFlags, header []string, records []T,
+) error {
+	if this.template != "" {
+		return writeTemplate(w, this.template, records)
+	}
+
+	switch this.format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(records)
+	case "csv":
+		return writeDelimited(w, ',', header, records)
+	case "tsv":
+		return writeDelimited(w, '\t', header, records)
+	default:
+		return fmt.Errorf("invalid output format \"%s\"", this.format)
+	}
+}
+
+func writeTemplate[T Record](w io.Writer, text string, records []T) error {
+	tmpl, err := template.New("avail").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		err = tmpl.Execute(w, r)
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasSuffix(text, "\n") {
+			_, err = io.WriteString(w, "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeDelimited[T Record](
+	w io.Writer, comma rune, header []string, records []T,
+) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		err = cw.Write(r.Row())
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testStatuses() SiteStatusList {
+	return SiteStatusList{
+		&SiteStatus{
+			SiteEntry: SiteEntry{
+				Title: "google", Url: "https://google.com", Interval: "5s",
+			},
+			State:   STATE_UP,
+			Latency: 42,
+			Health:  true,
+		},
+		&SiteStatus{
+			SiteEntry: SiteEntry{
+				Title: "example", Url: "https://example.com", Interval: "1m0s",
+			},
+			State:  STATE_DOWN,
+			Health: false,
+			Error:  "connection refused, again",
+		},
+	}
+}
+
+func TestWriteCsv(t *testing.T) {
+	var buf bytes.Buffer
+	of := OutputFlags{format: "csv"}
+
+	err := Write(&buf, &of, SiteStatusHeader, testStatuses())
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	expected := "title,url,interval,state,latency,health,error,since,sinceChange,group,tags\n" +
+		"google,https://google.com,5s,up,42,true,,,,,\n" +
+		"example,https://example.com,1m0s,down,0,false,\"connection refused, again\",,,,\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected csv output:\n%s", buf.String())
+		return
+	}
+}
+
+func TestWriteJson(t *testing.T) {
+	var buf bytes.Buffer
+	of := OutputFlags{format: "json"}
+
+	err := Write(&buf, &of, SiteStatusHeader, testStatuses())
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	var decoded []map[string]any
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if len(decoded) != 2 || decoded[0]["title"] != "google" ||
+		decoded[1]["url"] != "https://example.com" {
+		t.Fatalf("unexpected json output:\n%s", buf.String())
+		return
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	of := OutputFlags{format: "text", template: "{{.Title}}={{.Health}}"}
+
+	err := Write(&buf, &of, SiteStatusHeader, testStatuses())
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	if buf.String() != "google=true\nexample=false\n" {
+		t.Fatalf("unexpected template output:\n%s", buf.String())
+		return
+	}
+}
+
+func TestWriteProbeResult(t *testing.T) {
+	res := []ProbeResult{{
+		Title: "a", Url: "https://a.example.com",
+		Connect: Milliseconds(1500 * time.Microsecond),
+		Total:   Milliseconds(215131 * time.Nanosecond),
+	}}
+
+	for format, expected := range map[string]string{
+		"json": `"connect": 1.5`,
+		"yaml": "total: 0.215",
+		"csv":  ",0,1.5,0,0,0.215,",
+	} {
+		var buf bytes.Buffer
+		of := OutputFlags{format: format}
+		err := Write(&buf, &of, ProbeResultHeader, res)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("%s: expected %q in %q", format, expected, buf.String())
+			return
+		}
+	}
+}
@@ -0,0 +1,773 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/shlex"
+	"gopkg.in/yaml.v3"
+)
+
+// IMPORT_SOURCES are the tools avail import converts the targets of.
+var IMPORT_SOURCES = []string{"blackbox", "uptime-kuma", "gatus", "nagios"}
+
+type ImportOption = func(importer *Importer)
+
+// Importer converts the targets of another monitoring tool to sites. What
+// cannot be converted is reported as warnings, the rest is kept.
+type Importer struct {
+	// the blackbox exporter's own config, to resolve the modules of targets
+	modules *BlackboxConfig
+
+	sites    []InitSite
+	taken    []string
+	warnings []string
+}
+
+// ImportWithModules resolves the modules of blackbox exporter targets from
+// the exporter's config. Otherwise only its default modules are known.
+func ImportWithModules(modules *BlackboxConfig) ImportOption {
+	return func(importer *Importer) {
+		importer.modules = modules
+	}
+}
+
+// Import converts the targets defined in b by the tool, one of
+// IMPORT_SOURCES, to sites. The warnings list what could not be converted.
+func Import(tool string, b []byte, opts ...ImportOption) ([]InitSite, []string, error) {
+	importer := &Importer{
+		sites:    make([]InitSite, 0),
+		taken:    make([]string, 0),
+		warnings: make([]string, 0),
+	}
+	for _, o := range opts {
+		o(importer)
+	}
+
+	var err error
+	switch tool {
+	case "blackbox":
+		err = importer.importBlackbox(b)
+	case "uptime-kuma":
+		err = importer.importUptimeKuma(b)
+	case "gatus":
+		err = importer.importGatus(b)
+	case "nagios":
+		err = importer.importNagios(b)
+	default:
+		err = fmt.Errorf(
+			"unknown tool \"%s\", expected one of %s",
+			tool, strings.Join(IMPORT_SOURCES, ", "),
+		)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return importer.sites, importer.warnings, nil
+}
+
+func (this *Importer) warn(item string, format string, args ...any) {
+	this.warnings = append(this.warnings, item+": "+fmt.Sprintf(format, args...))
+}
+
+// add adds a site titled name, or after its URL if name is empty. Sites
+// that are not reached over http(s) are skipped.
+func (this *Importer) add(name string, site InitSite) {
+	item := name
+	if item == "" {
+		item = site.Url
+	}
+
+	u, err := url.Parse(site.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		this.warn(item, "skipped, only http(s) urls are monitored: %s", site.Url)
+		return
+	}
+
+	interval, _ := time.ParseDuration(site.Interval)
+	timeout, err := time.ParseDuration(site.Timeout)
+	if err == nil && timeout > interval {
+		site.Timeout = site.Interval
+	}
+
+	if name == "" {
+		site.Title = SuggestTitle(site.Url, this.taken)
+	} else {
+		site.Title = UniqueTitle(name, this.taken)
+	}
+	this.taken = append(this.taken, site.Title)
+	this.sites = append(this.sites, site)
+}
+
+// shortDuration formats a duration without zero units, e.g. 1m rather than
+// 1m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+var invalidTagChar = regexp.MustCompile(`[^A-Za-z0-9_./-]`)
+
+// importTag makes a tag key or value of another tool valid, replacing the
+// characters tags cannot have.
+func importTag(s string) string {
+	return invalidTagChar.ReplaceAllString(s, "-")
+}
+
+type gatusConfig struct {
+	Endpoints []gatusEndpoint `yaml:"endpoints"`
+}
+
+type gatusEndpoint struct {
+	Name       string            `yaml:"name"`
+	Group      string            `yaml:"group"`
+	Url        string            `yaml:"url"`
+	Method     string            `yaml:"method"`
+	Interval   string            `yaml:"interval"`
+	Enabled    *bool             `yaml:"enabled"`
+	Conditions []string          `yaml:"conditions"`
+	Headers    map[string]string `yaml:"headers"`
+	Body       string            `yaml:"body"`
+	Alerts     []any             `yaml:"alerts"`
+	Client     struct {
+		Timeout  string `yaml:"timeout"`
+		ProxyUrl string `yaml:"proxy-url"`
+		Insecure bool   `yaml:"insecure"`
+	} `yaml:"client"`
+}
+
+var gatusCondition = regexp.MustCompile(
+	`^\[([A-Z_]+)\]((?:\.[A-Za-z0-9_]+)*)\s*(==|!=|<=|>=|<|>)\s*(.+)$`,
+)
+
+// importGatus converts the endpoints of a gatus config. Conditions on the
+// status, on the body and on top-level fields of a JSON body are checked.
+func (this *Importer) importGatus(b []byte) error {
+	var cfg gatusConfig
+	err := yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range cfg.Endpoints {
+		item := e.Name
+		if e.Enabled != nil && !*e.Enabled {
+			this.warn(item, "skipped, disabled in gatus")
+			continue
+		}
+
+		site := InitSite{
+			Url: e.Url, Group: e.Group, Interval: "1m", Timeout: "10s",
+			Proxy: e.Client.ProxyUrl,
+		}
+		if d, err := time.ParseDuration(e.Interval); err == nil {
+			site.Interval = shortDuration(d)
+		}
+		if d, err := time.ParseDuration(e.Client.Timeout); err == nil {
+			site.Timeout = shortDuration(d)
+		}
+
+		if e.Method != "" && e.Method != "GET" {
+			this.warn(item, "method %s is not supported, GET is used", e.Method)
+		}
+		if len(e.Headers) != 0 || e.Body != "" {
+			this.warn(item, "request headers and body are not supported")
+		}
+		if e.Client.Insecure {
+			this.warn(item, "insecure TLS is not supported")
+		}
+		if len(e.Alerts) != 0 {
+			this.warn(item, "alerts are not imported")
+		}
+
+		conditions := CheckConditions{}
+		lo, hi := 100, 599
+		var codes []int
+		hasStatus := false
+		for _, c := range e.Conditions {
+			m := gatusCondition.FindStringSubmatch(strings.TrimSpace(c))
+			if m == nil {
+				this.warn(item, "condition %s is not supported", c)
+				continue
+			}
+			placeholder, field, op, value := m[1], m[2], m[3], strings.TrimSpace(m[4])
+
+			switch {
+			case placeholder == "CONNECTED" && field == "" && op == "==" && value == "true":
+			case placeholder == "STATUS" && field == "":
+				ok := true
+				switch op {
+				case "==":
+					codes, ok = gatusStatuses(value)
+				case "<", "<=", ">", ">=":
+					var n int
+					n, ok = atoi(value)
+					switch op {
+					case "<":
+						hi = min(hi, n-1)
+					case "<=":
+						hi = min(hi, n)
+					case ">":
+						lo = max(lo, n+1)
+					case ">=":
+						lo = max(lo, n)
+					}
+				default:
+					ok = false
+				}
+				if !ok {
+					this.warn(item, "condition %s is not supported", c)
+					continue
+				}
+				hasStatus = true
+			case placeholder == "BODY" && (op == "==" || op == "!="):
+				pattern, ok := gatusBodyPattern(field, value)
+				if !ok {
+					this.warn(item, "condition %s is not supported", c)
+					continue
+				}
+				if op == "==" {
+					conditions.Matches = append(conditions.Matches, pattern)
+				} else {
+					conditions.NotMatches = append(conditions.NotMatches, pattern)
+				}
+			default:
+				this.warn(item, "condition %s is not supported", c)
+			}
+		}
+
+		if hasStatus {
+			var statuses StatusSet
+			if codes != nil {
+				for _, code := range codes {
+					if lo <= code && code <= hi {
+						statuses.Codes = append(statuses.Codes, code)
+					}
+				}
+			} else {
+				statuses = StatusRange(lo, hi)
+			}
+			conditions.Statuses = &statuses
+		} else {
+			this.warn(item, "no status condition, a 2xx status is expected")
+		}
+		site.Check = conditions.Check()
+
+		this.add(e.Name, site)
+	}
+
+	return nil
+}
+
+// gatusStatuses parses the value of a status condition, e.g. 200 or
+// any(200, 204).
+func gatusStatuses(value string) ([]int, bool) {
+	inner, ok := strings.CutPrefix(value, "any(")
+	if ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+		if !ok {
+			return nil, false
+		}
+	}
+
+	ret := make([]int, 0)
+	for _, s := range strings.Split(inner, ",") {
+		code, ok := atoi(s)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, code)
+	}
+	return ret, true
+}
+
+// gatusBodyPattern converts the value of a body condition to a pattern. Of
+// JSON bodies, only top-level fields are supported.
+func gatusBodyPattern(field, value string) (string, bool) {
+	if strings.HasPrefix(value, "pat(") && strings.HasSuffix(value, ")") {
+		if field != "" {
+			return "", false
+		}
+		glob := strings.TrimSuffix(strings.TrimPrefix(value, "pat("), ")")
+		parts := strings.Split(glob, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		return strings.Join(parts, ".*"), true
+	}
+	if strings.ContainsAny(value, "()") {
+		return "", false
+	}
+
+	if field == "" {
+		return "^" + regexp.QuoteMeta(value) + "$", true
+	}
+	key := strings.TrimPrefix(field, ".")
+	if strings.Contains(key, ".") {
+		return "", false
+	}
+
+	_, err := strconv.ParseFloat(value, 64)
+	isString := err != nil && value != "true" && value != "false" && value != "null"
+	return jsonFieldPattern(key, value, isString), true
+}
+
+func atoi(s string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	return n, err == nil
+}
+
+type uptimeKumaBackup struct {
+	MonitorList []uptimeKumaMonitor `json:"monitorList"`
+}
+
+type uptimeKumaMonitor struct {
+	Id                  int             `json:"id"`
+	Name                string          `json:"name"`
+	Type                string          `json:"type"`
+	Url                 string          `json:"url"`
+	Method              string          `json:"method"`
+	Interval            int             `json:"interval"`
+	Timeout             float64         `json:"timeout"`
+	Keyword             string          `json:"keyword"`
+	InvertKeyword       uptimeKumaBool  `json:"invertKeyword"`
+	IgnoreTls           uptimeKumaBool  `json:"ignoreTls"`
+	AcceptedStatuscodes []string        `json:"accepted_statuscodes"`
+	Parent              *int            `json:"parent"`
+	ProxyId             *int            `json:"proxyId"`
+	Headers             *string         `json:"headers"`
+	Body                *string         `json:"body"`
+	Tags                []uptimeKumaTag `json:"tags"`
+}
+
+type uptimeKumaTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// uptimeKumaBool is a flag of a backup, which older versions write as 0 or
+// 1.
+type uptimeKumaBool bool
+
+func (this *uptimeKumaBool) UnmarshalJSON(b []byte) error {
+	var v any
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*this = uptimeKumaBool(v)
+	case float64:
+		*this = v != 0
+	}
+	return nil
+}
+
+// importUptimeKuma converts the monitors of an Uptime Kuma backup. HTTP and
+// keyword monitors are supported, the groups they are in become their
+// group.
+func (this *Importer) importUptimeKuma(b []byte) error {
+	var backup uptimeKumaBackup
+	err := json.Unmarshal(b, &backup)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[int]string)
+	for _, m := range backup.MonitorList {
+		if m.Type == "group" {
+			groups[m.Id] = m.Name
+		}
+	}
+
+	for _, m := range backup.MonitorList {
+		item := m.Name
+		switch m.Type {
+		case "group":
+			continue
+		case "http", "keyword":
+		case "json-query":
+			this.warn(item, "json queries are not supported, only the status is checked")
+		default:
+			this.warn(item, "skipped, %s monitors are not supported", m.Type)
+			continue
+		}
+
+		interval := time.Duration(m.Interval) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		timeout := time.Duration(m.Timeout * float64(time.Second)).Round(time.Second)
+		if timeout <= 0 {
+			// the default of Uptime Kuma
+			timeout = interval * 8 / 10
+		}
+
+		site := InitSite{
+			Url:      m.Url,
+			Interval: shortDuration(interval),
+			Timeout:  shortDuration(timeout),
+		}
+		if m.Parent != nil {
+			site.Group = groups[*m.Parent]
+		}
+		for _, tag := range m.Tags {
+			if site.Tags == nil {
+				site.Tags = make(map[string]string)
+			}
+			site.Tags[importTag(tag.Name)] = importTag(tag.Value)
+		}
+
+		if m.Method != "" && strings.ToUpper(m.Method) != "GET" {
+			this.warn(item, "method %s is not supported, GET is used", m.Method)
+		}
+		if (m.Headers != nil && *m.Headers != "") || (m.Body != nil && *m.Body != "") {
+			this.warn(item, "request headers and body are not supported")
+		}
+		if m.IgnoreTls {
+			this.warn(item, "ignoring TLS errors is not supported")
+		}
+		if m.ProxyId != nil {
+			this.warn(item, "proxies are not imported, set proxy by hand")
+		}
+
+		conditions := CheckConditions{}
+		if len(m.AcceptedStatuscodes) != 0 {
+			var statuses StatusSet
+			for _, codes := range m.AcceptedStatuscodes {
+				lo, hi, isRange := strings.Cut(codes, "-")
+				if !isRange {
+					hi = lo
+				}
+				l, okLo := atoi(lo)
+				h, okHi := atoi(hi)
+				if !okLo || !okHi {
+					this.warn(item, "accepted status codes %s are not supported", codes)
+					continue
+				}
+				statuses.Add(StatusRange(l, h))
+			}
+			conditions.Statuses = &statuses
+		}
+		if m.Type == "keyword" && m.Keyword != "" {
+			pattern := regexp.QuoteMeta(m.Keyword)
+			if m.InvertKeyword {
+				conditions.NotMatches = append(conditions.NotMatches, pattern)
+			} else {
+				conditions.Matches = append(conditions.Matches, pattern)
+			}
+		}
+		site.Check = conditions.Check()
+
+		this.add(m.Name, site)
+	}
+
+	return nil
+}
+
+type nagiosObject struct {
+	kind   string
+	fields map[string]string
+}
+
+// parseNagios parses object definitions, e.g. define host { ... }.
+func parseNagios(b []byte) ([]nagiosObject, error) {
+	ret := make([]nagiosObject, 0)
+	var current *nagiosObject
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(stripNagiosComment(line))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if current == nil {
+			rest, ok := strings.CutPrefix(line, "define")
+			kind, open := strings.CutSuffix(strings.TrimSpace(rest), "{")
+			if !ok || !open {
+				return nil, fmt.Errorf("line %d: expected define <type> {", i+1)
+			}
+			current = &nagiosObject{
+				kind: strings.TrimSpace(kind), fields: make(map[string]string),
+			}
+			continue
+		}
+
+		if line == "}" {
+			ret = append(ret, *current)
+			current = nil
+			continue
+		}
+		key, value, _ := strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		current.fields[key] = strings.TrimSpace(value)
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated definition of %s", current.kind)
+	}
+
+	return ret, nil
+}
+
+// stripNagiosComment removes the comment starting at a ';' that is not
+// escaped as \;.
+func stripNagiosComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == ';' && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+			break
+		}
+	}
+	return strings.ReplaceAll(line, `\;`, ";")
+}
+
+// resolveNagios fills in the fields objects inherit from the templates they
+// use.
+func resolveNagios(objects []nagiosObject) {
+	templates := make(map[string]map[string]string)
+	for _, o := range objects {
+		if name, ok := o.fields["name"]; ok {
+			templates[o.kind+"\x00"+name] = o.fields
+		}
+	}
+
+	var resolve func(kind string, fields map[string]string, depth int)
+	resolve = func(kind string, fields map[string]string, depth int) {
+		use, ok := fields["use"]
+		if !ok || depth > 16 {
+			return
+		}
+		delete(fields, "use")
+		for _, name := range strings.Split(use, ",") {
+			template, ok := templates[kind+"\x00"+strings.TrimSpace(name)]
+			if !ok {
+				continue
+			}
+			resolve(kind, template, depth+1)
+			for k, v := range template {
+				_, set := fields[k]
+				if !set && k != "name" && k != "register" {
+					fields[k] = v
+				}
+			}
+		}
+	}
+	for _, o := range objects {
+		resolve(o.kind, o.fields, 0)
+	}
+}
+
+var nagiosMacro = regexp.MustCompile(`\$([A-Z0-9_]+)\$`)
+
+// NAGIOS_HTTP_PLUGINS are the plugins of nagios services that are
+// converted.
+var NAGIOS_HTTP_PLUGINS = []string{"check_http", "check_https", "check_curl"}
+
+// importNagios converts the services of nagios object definitions that
+// check http(s) with check_http or check_curl, of each of their hosts. The
+// host becomes the group of its services.
+func (this *Importer) importNagios(b []byte) error {
+	objects, err := parseNagios(b)
+	if err != nil {
+		return err
+	}
+	resolveNagios(objects)
+
+	addresses := make(map[string]string)
+	commands := make(map[string]string)
+	for _, o := range objects {
+		switch o.kind {
+		case "host":
+			if name, ok := o.fields["host_name"]; ok {
+				addresses[name] = o.fields["address"]
+				if addresses[name] == "" {
+					addresses[name] = name
+				}
+			}
+		case "command":
+			commands[o.fields["command_name"]] = o.fields["command_line"]
+		}
+	}
+
+	for _, o := range objects {
+		if o.kind != "service" || o.fields["register"] == "0" {
+			continue
+		}
+		description := o.fields["service_description"]
+		if o.fields["hostgroup_name"] != "" {
+			this.warn(description, "hostgroups are not supported, only host_name is used")
+		}
+
+		interval := 5 * time.Minute
+		if minutes, err := strconv.ParseFloat(o.fields["check_interval"], 64); err == nil {
+			interval = time.Duration(minutes * float64(time.Minute))
+		}
+
+		for _, host := range strings.Split(o.fields["host_name"], ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				continue
+			}
+			item := host + "-" + description
+
+			args := strings.Split(o.fields["check_command"], "!")
+			commandLine, ok := commands[args[0]]
+			if !ok {
+				commandLine = strings.Join(args, " ")
+			}
+			commandLine = nagiosMacro.ReplaceAllStringFunc(commandLine, func(m string) string {
+				macro := strings.Trim(m, "$")
+				switch {
+				case macro == "HOSTADDRESS":
+					return addresses[host]
+				case macro == "HOSTNAME":
+					return host
+				case strings.HasPrefix(macro, "ARG"):
+					n, err := strconv.Atoi(strings.TrimPrefix(macro, "ARG"))
+					if err == nil && 0 < n && n < len(args) {
+						return args[n]
+					}
+					return ""
+				}
+				return m
+			})
+
+			tokens, err := shlex.Split(commandLine)
+			if err != nil || len(tokens) == 0 {
+				this.warn(item, "skipped, invalid check_command")
+				continue
+			}
+			plugin := path.Base(tokens[0])
+			if !slices.Contains(NAGIOS_HTTP_PLUGINS, plugin) {
+				this.warn(item, "skipped, the %s plugin is not supported", plugin)
+				continue
+			}
+
+			site := InitSite{
+				Group: host, Interval: shortDuration(interval), Timeout: "10s",
+			}
+			site.Url, site.Check = this.nagiosHttpCheck(
+				item, tokens[1:], addresses[host], plugin == "check_https", &site,
+			)
+			this.add(item, site)
+		}
+	}
+
+	return nil
+}
+
+var nagiosStatus = regexp.MustCompile(`\b[1-5][0-9]{2}\b`)
+
+// flags of check_http that do not take a value
+var nagiosHttpSwitches = []string{
+	"-S", "--ssl", "--invert-regex", "-N", "--no-body", "-E", "--extended-perfdata",
+	"-4", "-6", "--sni", "-L", "--link",
+}
+
+// nagiosHttpCheck converts the arguments of check_http to the URL and the
+// check of a site, setting its timeout.
+func (this *Importer) nagiosHttpCheck(
+	item string, args []string, address string, ssl bool, site *InitSite,
+) (string, *InitCheck) {
+	hostname, ip, port, uri := "", "", "", "/"
+	conditions := CheckConditions{}
+	invert := false
+	regexes := make([]string, 0)
+
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(flag, "--") && len(flag) > 2 {
+			flag, value, hasValue = flag[:2], flag[2:], true
+		}
+		if slices.Contains(nagiosHttpSwitches, flag) {
+			switch flag {
+			case "-S", "--ssl":
+				ssl = true
+			case "--invert-regex":
+				invert = true
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				this.warn(item, "missing value of %s", flag)
+				break
+			}
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "-H", "--hostname":
+			hostname = value
+		case "-I", "--IP-address":
+			ip = value
+		case "-p", "--port":
+			port = value
+		case "-u", "--url", "--uri":
+			uri = value
+		case "-t", "--timeout":
+			if seconds, ok := atoi(value); ok {
+				site.Timeout = shortDuration(time.Duration(seconds) * time.Second)
+			}
+		case "-e", "--expect":
+			statuses := StatusSet{}
+			for _, expected := range strings.Split(value, ",") {
+				if code, ok := atoi(nagiosStatus.FindString(expected)); ok {
+					statuses.Add(StatusSet{Codes: []int{code}})
+				}
+			}
+			conditions.Statuses = &statuses
+		case "-s", "--string":
+			conditions.Matches = append(conditions.Matches, regexp.QuoteMeta(value))
+		case "-r", "--regex", "--ereg":
+			regexes = append(regexes, value)
+		case "-j", "--method":
+			if strings.ToUpper(value) != "GET" {
+				this.warn(item, "method %s is not supported, GET is used", value)
+			}
+		case "-f", "--onredirect":
+		case "-w", "--warning", "-c", "--critical":
+			this.warn(item, "response time thresholds are not supported")
+		default:
+			this.warn(item, "%s is not supported", flag)
+		}
+	}
+
+	if invert {
+		conditions.NotMatches = append(conditions.NotMatches, regexes...)
+	} else {
+		conditions.Matches = append(conditions.Matches, regexes...)
+	}
+
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return uri, conditions.Check()
+	}
+
+	host := cmp.Or(hostname, ip, address)
+	u := url.URL{Scheme: "http", Host: host, Path: uri}
+	if ssl {
+		u.Scheme = "https"
+	}
+	if port != "" {
+		u.Host = host + ":" + port
+	}
+	if p, query, ok := strings.Cut(uri, "?"); ok {
+		u.Path, u.RawQuery = p, query
+	}
+	return u.String(), conditions.Check()
+}
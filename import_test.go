@@ -0,0 +1,250 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		tool     string
+		in       string
+		sites    []InitSite
+		warnings int
+	}{
+		{
+			tool: "gatus",
+			in: `
+endpoints:
+  - name: website
+    group: core
+    url: "https://example.com/health"
+    interval: 5m
+    conditions:
+      - "[STATUS] == 200"
+      - "[BODY].status == UP"
+      - "[RESPONSE_TIME] < 300"
+  - name: dns
+    url: "8.8.8.8"
+    conditions: ["[DNS_RCODE] == NOERROR"]
+`,
+			sites: []InitSite{{
+				Title: "website", Url: "https://example.com/health",
+				Group: "core", Interval: "5m", Timeout: "10s",
+				Check: &InitCheck{
+					Type:   "shell",
+					Script: `[ "$(avail http status)" = 200 ] && avail http body | grep -Eq '"status" *: *"UP"'`,
+				},
+			}},
+			warnings: 4,
+		},
+		{
+			tool: "uptime-kuma",
+			in: `{"monitorList": [
+  {"id": 1, "name": "Prod", "type": "group"},
+  {"id": 2, "name": "Shop", "type": "keyword", "url": "https://shop.example.com",
+   "interval": 60, "timeout": 48, "keyword": "cart", "invertKeyword": true,
+   "accepted_statuscodes": ["200-299"], "parent": 1,
+   "tags": [{"name": "env", "value": "prod"}]},
+  {"id": 3, "name": "DB", "type": "port", "hostname": "db", "port": 5432}
+]}`,
+			sites: []InitSite{{
+				Title: "Shop", Url: "https://shop.example.com",
+				Group: "Prod", Interval: "1m", Timeout: "48s",
+				Tags: map[string]string{"env": "prod"},
+				Check: &InitCheck{
+					Type: "shell", Script: "! avail http body | grep -Eq 'cart'",
+				},
+			}},
+			warnings: 1,
+		},
+		{
+			tool: "nagios",
+			in: `
+define command {
+  command_name check_http_url
+  command_line $USER1$/check_http -H $HOSTADDRESS$ -u $ARG1$ $ARG2$
+}
+define service {
+  name generic-service
+  check_interval 5
+  register 0
+}
+define host {
+  host_name web1
+  address 10.0.0.5
+}
+define service {
+  use generic-service
+  host_name web1
+  service_description health ; the health endpoint
+  check_command check_http_url!/health!-S -e 200,204 -t 5
+}
+define service {
+  use generic-service
+  host_name web1
+  service_description ssh
+  check_command check_ssh
+}
+`,
+			sites: []InitSite{{
+				Title: "web1-health", Url: "https://10.0.0.5/health",
+				Group: "web1", Interval: "5m", Timeout: "5s",
+				Check: &InitCheck{
+					Type: "shell", Script: "avail http status | grep -Eqx '200|204'",
+				},
+			}},
+			warnings: 1,
+		},
+		{
+			tool: "blackbox",
+			in: `
+global: {scrape_interval: 30s}
+scrape_configs:
+  - job_name: blackbox
+    metrics_path: /probe
+    params: {module: [http_2xx]}
+    static_configs:
+      - targets: [https://a.example.com]
+        labels: {env: prod, group: edge}
+  - job_name: node
+    static_configs: [{targets: [localhost:9100]}]
+`,
+			sites: []InitSite{{
+				Title: "blackbox", Url: "https://a.example.com",
+				Group: "edge", Interval: "30s", Timeout: "10s",
+				Tags: map[string]string{"env": "prod"},
+			}},
+			warnings: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		sites, warnings, err := Import(tt.tool, []byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.tool, err)
+			return
+		}
+		if len(sites) != len(tt.sites) {
+			t.Fatalf("%s: unexpected sites: %+v", tt.tool, sites)
+			return
+		}
+		for i := range sites {
+			got, want := sites[i], tt.sites[i]
+			if got.Title != want.Title || got.Url != want.Url ||
+				got.Group != want.Group || got.Interval != want.Interval ||
+				got.Timeout != want.Timeout || len(got.Tags) != len(want.Tags) ||
+				(got.Check == nil) != (want.Check == nil) ||
+				(got.Check != nil && *got.Check != *want.Check) {
+				t.Fatalf("%s: expected %+v, got %+v (check %+v)", tt.tool, want, got, got.Check)
+				return
+			}
+			for k, v := range want.Tags {
+				if got.Tags[k] != v {
+					t.Fatalf("%s: unexpected tags: %v", tt.tool, got.Tags)
+					return
+				}
+			}
+		}
+		if len(warnings) != tt.warnings {
+			t.Fatalf("%s: unexpected warnings: %q", tt.tool, warnings)
+			return
+		}
+	}
+
+	_, _, err := Import("zabbix", nil)
+	if err == nil {
+		t.Fatal("expected an unknown tool to be rejected")
+		return
+	}
+}
+
+func TestCheckConditions(t *testing.T) {
+	statuses := StatusRange(200, 399)
+	statuses.Add(StatusSet{Codes: []int{404}})
+	conditions := CheckConditions{
+		Statuses:   &statuses,
+		Matches:    []string{jsonFieldPattern("status", "it's ok", true)},
+		NotMatches: []string{"error"},
+	}
+
+	check := conditions.Check()
+	if check == nil {
+		t.Fatal("expected a check")
+		return
+	}
+	parsed, ok := ParseCheckConditions(check.Script)
+	if !ok {
+		t.Fatalf("check not understood: %s", check.Script)
+		return
+	}
+	if !slices.Equal(parsed.Statuses.Classes, []int{2, 3}) ||
+		!slices.Equal(parsed.Statuses.Codes, []int{404}) ||
+		!slices.Equal(parsed.Matches, conditions.Matches) ||
+		!slices.Equal(parsed.NotMatches, conditions.NotMatches) {
+		t.Fatalf("unexpected conditions: %+v", parsed)
+		return
+	}
+
+	def := StatusRange(200, 299)
+	if (CheckConditions{Statuses: &def}).Check() != nil {
+		t.Fatal("expected no check for 2xx")
+		return
+	}
+	if _, ok := ParseCheckConditions("curl -f https://example.com"); ok {
+		t.Fatal("expected other scripts not to be understood")
+		return
+	}
+}
+
+func TestExportBlackbox(t *testing.T) {
+	group := config.Group("edge")
+	statuses := StatusSet{Codes: []int{200, 204}}
+	script := CheckConditions{
+		Statuses: &statuses, Matches: []string{"ok"},
+	}.Check().Script
+	sites := []config.Ping{
+		{
+			Title: "api v1", Url: "https://api.example.com", Interval: "30s",
+			Timeout: "5s", Group: &group, Tags: config.Tags{"env": "prod"},
+			Check: map[string]any{"type": "shell", "script": script},
+		},
+		{
+			Title: "other", Url: "https://example.com", Interval: "1m",
+			Timeout: "5s",
+			Check:   map[string]any{"type": "shell", "script": "true"},
+		},
+	}
+
+	export, err := ExportBlackbox(sites, BLACKBOX_EXPORTER)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(export.Warnings) != 1 || !strings.HasPrefix(export.Warnings[0], "other: ") {
+		t.Fatalf("unexpected warnings: %q", export.Warnings)
+		return
+	}
+	module, ok := export.Modules.Modules["api_v1"]
+	if !ok || module.Prober != "http" || module.Timeout != "5s" {
+		t.Fatalf("unexpected modules: %+v", export.Modules.Modules)
+		return
+	}
+	codes, _ := module.Http["valid_status_codes"].([]int)
+	if !slices.Equal(codes, []int{200, 204}) {
+		t.Fatalf("unexpected module: %+v", module)
+		return
+	}
+
+	job := export.Scrape.ScrapeConfigs[0]
+	if job.ScrapeInterval != "30s" || job.Params["module"][0] != "api_v1" ||
+		job.StaticConfigs[0].Labels["group"] != "edge" ||
+		job.StaticConfigs[0].Labels["env"] != "prod" ||
+		job.RelabelConfigs[2].Replacement != BLACKBOX_EXPORTER {
+		t.Fatalf("unexpected scrape config: %+v", job)
+		return
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thekhanj/avail/common"
 	"golang.org/x/term"
@@ -32,15 +34,178 @@ func (this SiteStatusList) String() string {
 func (this *SiteStatusList) MaxTitleLength(opts ...SiteStatusOption) int {
 	max := 0
 	for _, s := range *this {
-		if len(s.title) > max {
-			max = len(s.title)
+		if len(s.Title) > max {
+			max = len(s.Title)
 		}
 	}
 	return max
 }
 
+func (this SiteStatusList) Entries() []SiteEntry {
+	ret := make([]SiteEntry, len(this))
+	for i, s := range this {
+		ret[i] = s.SiteEntry
+	}
+	return ret
+}
+
+// State aggregates the states of all sites in the list, ignoring paused
+// ones. It is STATE_UP only if every site is up, STATE_DOWN if every site is
+// down and STATE_DEGRADED if only some of them are down. Otherwise, if some
+// sites have not been checked yet or no site is monitored at all, it is
+// STATE_UNKNOWN.
+func (this SiteStatusList) State() State {
+	total := 0
+	down := 0
+	unknown := 0
+	for _, s := range this {
+		switch s.State {
+		case STATE_PAUSED:
+			continue
+		case STATE_DOWN:
+			down++
+		case STATE_UNKNOWN:
+			unknown++
+		}
+		total++
+	}
+
+	switch {
+	case total == 0:
+		return STATE_UNKNOWN
+	case down != 0 && down == total:
+		return STATE_DOWN
+	case down != 0:
+		return STATE_DEGRADED
+	case unknown != 0:
+		return STATE_UNKNOWN
+	default:
+		return STATE_UP
+	}
+}
+
 var _ fmt.Stringer = (*SiteStatusList)(nil)
 
+// SiteStatusGroup is a section of avail status -grouped, the sites of a
+// group along with their aggregate state.
+type SiteStatusGroup struct {
+	Group string         `json:"group" yaml:"group"`
+	State State          `json:"state" yaml:"state"`
+	Up    int            `json:"up" yaml:"up"`
+	Total int            `json:"total" yaml:"total"`
+	Sites SiteStatusList `json:"sites" yaml:"sites"`
+}
+
+// UNGROUPED is the name of the section of the sites without a group.
+const UNGROUPED = "ungrouped"
+
+// GroupStatuses splits the list into its groups, in the order they first
+// appear, followed by the sites without a group.
+func GroupStatuses(statuses SiteStatusList) []SiteStatusGroup {
+	names := make([]string, 0)
+	sites := make(map[string]SiteStatusList)
+	for _, s := range statuses {
+		name := s.Group
+		if name == "" {
+			name = UNGROUPED
+		}
+		if _, ok := sites[name]; !ok && name != UNGROUPED {
+			names = append(names, name)
+		}
+		sites[name] = append(sites[name], s)
+	}
+	if _, ok := sites[UNGROUPED]; ok {
+		names = append(names, UNGROUPED)
+	}
+
+	ret := make([]SiteStatusGroup, len(names))
+	for i, name := range names {
+		group := SiteStatusGroup{Group: name, State: sites[name].State(), Sites: sites[name]}
+		for _, s := range group.Sites {
+			if s.State != STATE_PAUSED {
+				group.Total++
+			}
+			if s.State == STATE_UP {
+				group.Up++
+			}
+		}
+		ret[i] = group
+	}
+	return ret
+}
+
+func (this SiteStatusGroup) String() string {
+	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
+
+	state := this.State.Label()
+	if isTTY {
+		state = this.State.Color() + state + COLOR_RESET
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s: %s (%d/%d up)", this.Group, state, this.Up, this.Total),
+	}
+	for _, s := range this.Sites {
+		lines = append(lines, "  "+s.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+var SiteStatusGroupHeader = []string{"group", "state", "up", "total"}
+
+func (this SiteStatusGroup) Row() []string {
+	return []string{
+		this.Group, string(this.State),
+		strconv.Itoa(this.Up), strconv.Itoa(this.Total),
+	}
+}
+
+var _ fmt.Stringer = (*SiteStatusGroup)(nil)
+var _ Record = (*SiteStatusGroup)(nil)
+
+const (
+	COLOR_LATENCY = "\x1b[36m"
+	COLOR_RESET   = "\x1b[0m"
+)
+
+type State string
+
+const (
+	STATE_UP      State = "up"
+	STATE_DOWN    State = "down"
+	STATE_UNKNOWN State = "unknown"
+	STATE_PAUSED  State = "paused"
+	// Only used for aggregates, see SiteStatusList.State
+	STATE_DEGRADED State = "degraded"
+)
+
+// Label is the human readable form of the state.
+func (this State) Label() string {
+	switch this {
+	case STATE_UP:
+		return "OK"
+	case STATE_DOWN:
+		return "FAILED"
+	default:
+		return strings.ToUpper(string(this))
+	}
+}
+
+// Color is the ANSI escape sequence used to highlight the state on
+// terminals.
+func (this State) Color() string {
+	switch this {
+	case STATE_UP:
+		return "\x1b[1m\x1b[32m"
+	case STATE_DOWN:
+		return "\x1b[1m\x1b[31m"
+	case STATE_PAUSED:
+		return "\x1b[1m\x1b[34m"
+	default:
+		return "\x1b[1m\x1b[33m"
+	}
+}
+
 type SiteStatusOption = func(*SiteStatus)
 
 func SiteStatusWithTitleLength(titleLength int) SiteStatusOption {
@@ -49,12 +214,34 @@ func SiteStatusWithTitleLength(titleLength int) SiteStatusOption {
 	}
 }
 
+type SiteEntry struct {
+	Title    string            `json:"title" yaml:"title"`
+	Url      string            `json:"url" yaml:"url"`
+	Interval string            `json:"interval" yaml:"interval"`
+	Group    string            `json:"group,omitempty" yaml:"group,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+var SiteEntryHeader = []string{"title", "url", "interval", "group", "tags"}
+
+func (this SiteEntry) Row() []string {
+	return []string{
+		this.Title, this.Url, this.Interval, this.Group, formatTags(this.Tags),
+	}
+}
+
+var _ Record = (*SiteEntry)(nil)
+
 type SiteStatus struct {
-	title       string
+	SiteEntry   `yaml:",inline"`
 	titleLength int
 
-	Latency int64
-	Health  bool
+	State       State     `json:"state" yaml:"state"`
+	Latency     int64     `json:"latency" yaml:"latency"`
+	Health      bool      `json:"health" yaml:"health"`
+	Error       string    `json:"error" yaml:"error"`
+	Since       time.Time `json:"since" yaml:"since"`
+	SinceChange string    `json:"sinceChange" yaml:"sinceChange"`
 }
 
 func (this *SiteStatus) Apply(opts ...SiteStatusOption) {
@@ -73,20 +260,9 @@ func (this SiteStatus) String() string {
 
 	if isTTY {
 		titleColor = ""
-		latencyColor = "\x1b[36m"
-
-		if this.Health {
-			healthColor = "\x1b[1m\x1b[32m"
-		} else {
-			healthColor = "\x1b[1m\x1b[31m"
-		}
-
-		colorReset = "\x1b[0m"
-	}
-
-	health := "OK"
-	if !this.Health {
-		health = "FAILED"
+		latencyColor = COLOR_LATENCY
+		healthColor = this.State.Color()
+		colorReset = COLOR_RESET
 	}
 
 	titleLength := this.titleLength
@@ -96,13 +272,78 @@ func (this SiteStatus) String() string {
 
 	return fmt.Sprintf(
 		"%s%-"+strconv.Itoa(titleLength+1)+"s%s %s%s%s (latency: %s%d ms%s)",
-		titleColor, this.title+":", colorReset,
-		healthColor, health, colorReset,
+		titleColor, this.Title+":", colorReset,
+		healthColor, this.State.Label(), colorReset,
 		latencyColor, this.Latency, colorReset,
 	)
 }
 
+// group and tags come last, so that the columns of scripts written before
+// they existed keep their positions
+var SiteStatusHeader = []string{
+	"title", "url", "interval",
+	"state", "latency", "health", "error", "since", "sinceChange",
+	"group", "tags",
+}
+
+func (this SiteStatus) Row() []string {
+	since := ""
+	if !this.Since.IsZero() {
+		since = this.Since.Format(time.RFC3339)
+	}
+
+	return []string{
+		this.Title,
+		this.Url,
+		this.Interval,
+		string(this.State),
+		strconv.FormatInt(this.Latency, 10),
+		strconv.FormatBool(this.Health),
+		this.Error,
+		since,
+		this.SinceChange,
+		this.Group,
+		formatTags(this.Tags),
+	}
+}
+
 var _ fmt.Stringer = (*SiteStatus)(nil)
+var _ Record = (*SiteStatus)(nil)
+
+const HISTORY_SIZE = 60
+
+// Sample is the outcome of a single check, as stored in a site's history
+// file.
+type Sample struct {
+	Time    time.Time `json:"time"`
+	Latency int64     `json:"latency"`
+	Health  bool      `json:"health"`
+}
+
+func ParseSample(line string) (Sample, error) {
+	var unix, latency int64
+	var health int
+
+	_, err := fmt.Sscanf(line, "%d %d %d", &unix, &latency, &health)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid history sample \"%s\": %w", line, err)
+	}
+
+	return Sample{
+		Time:    time.Unix(unix, 0),
+		Latency: latency,
+		Health:  health != 0,
+	}, nil
+}
+
+func (this Sample) String() string {
+	health := 0
+	if this.Health {
+		health = 1
+	}
+
+	return fmt.Sprintf("%d %d %d", this.Time.Unix(), this.Latency, health)
+}
 
 func NewInfo(pid int) *Info {
 	return &Info{pid}
@@ -130,7 +371,17 @@ func (this *Info) Titles() ([]string, error) {
 	return titles, nil
 }
 
+// SitesStatus returns the status of the given sites, or all sites if titles
+// is empty.
 func (this *Info) SitesStatus(titles []string) (SiteStatusList, error) {
+	if len(titles) == 0 {
+		var err error
+		titles, err = this.Titles()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ret := make(SiteStatusList, len(titles))
 	for i, title := range titles {
 		s, err := this.SiteStatus(title)
@@ -146,12 +397,73 @@ func (this *Info) SitesStatus(titles []string) (SiteStatusList, error) {
 	return ret, nil
 }
 
+func (this *Info) SiteEntry(title string) (SiteEntry, error) {
+	ret := SiteEntry{Title: title}
+	dir := filepath.Join(common.GetPidVarDir(this.pid), title)
+
+	_, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return ret, fmt.Errorf("site not found: %s", title)
+	}
+	if err != nil {
+		return ret, err
+	}
+
+	url, err := this.readOptional(filepath.Join(dir, "url"))
+	if err != nil {
+		return ret, err
+	}
+	interval, err := this.readOptional(filepath.Join(dir, "interval"))
+	if err != nil {
+		return ret, err
+	}
+	group, err := this.readOptional(filepath.Join(dir, "group"))
+	if err != nil {
+		return ret, err
+	}
+	tags, err := this.readOptional(filepath.Join(dir, "tags"))
+	if err != nil {
+		return ret, err
+	}
+
+	ret.Url = url
+	ret.Interval = interval
+	ret.Group = group
+	ret.Tags = parseTags(tags)
+
+	return ret, nil
+}
+
 func (this *Info) SiteStatus(title string) (SiteStatus, error) {
-	ret := SiteStatus{title: title}
+	ret, err := this.readSiteStatus(title)
+	if err != nil {
+		return ret, err
+	}
+
+	paused := filepath.Join(common.GetPidVarDir(this.pid), title, "paused")
+	_, err = os.Stat(paused)
+	if err == nil {
+		ret.State = STATE_PAUSED
+	}
+
+	return ret, nil
+}
+
+func (this *Info) readSiteStatus(title string) (SiteStatus, error) {
+	entry, err := this.SiteEntry(title)
+	if err != nil {
+		return SiteStatus{}, err
+	}
+
+	ret := SiteStatus{SiteEntry: entry, State: STATE_UNKNOWN}
 	dir := filepath.Join(common.GetPidVarDir(this.pid), title)
 
 	latencyFile := filepath.Join(dir, "latency")
 	b, err := os.ReadFile(latencyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		// not checked yet
+		return ret, nil
+	}
 	if err != nil {
 		return ret, err
 	}
@@ -165,6 +477,9 @@ func (this *Info) SiteStatus(title string) (SiteStatus, error) {
 
 	healthFile := filepath.Join(dir, "health")
 	b, err = os.ReadFile(healthFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return ret, nil
+	}
 	if err != nil {
 		return ret, err
 	}
@@ -173,12 +488,72 @@ func (this *Info) SiteStatus(title string) (SiteStatus, error) {
 		return ret, err
 	}
 
+	lastErr, err := this.readOptional(filepath.Join(dir, "error"))
+	if err != nil {
+		return ret, err
+	}
+
+	since, err := this.readOptional(filepath.Join(dir, "since"))
+	if err != nil {
+		return ret, err
+	}
+	if since != "" {
+		ret.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return ret, err
+		}
+		ret.SinceChange = time.Since(ret.Since).Round(time.Second).String()
+	}
+
 	ret.Latency = latency
+	ret.Error = lastErr
 	if health == 0 {
 		ret.Health = false
+		ret.State = STATE_DOWN
 	} else {
 		ret.Health = true
+		ret.State = STATE_UP
+	}
+
+	return ret, nil
+}
+
+// History returns up to HISTORY_SIZE of the most recent samples of a site,
+// oldest first.
+func (this *Info) History(title string) ([]Sample, error) {
+	path := filepath.Join(common.GetPidVarDir(this.pid), title, "history")
+
+	content, err := this.readOptional(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Sample, 0, HISTORY_SIZE)
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			continue
+		}
+
+		sample, err := ParseSample(line)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, sample)
 	}
 
 	return ret, nil
 }
+
+// readOptional returns the trimmed content of a file, or an empty string
+// if the file does not exist (e.g. written by an older daemon).
+func (this *Info) readOptional(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
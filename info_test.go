@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestSiteStatusListState(t *testing.T) {
+	list := func(states ...State) SiteStatusList {
+		ret := make(SiteStatusList, len(states))
+		for i, s := range states {
+			ret[i] = &SiteStatus{State: s}
+		}
+		return ret
+	}
+
+	cases := []struct {
+		list     SiteStatusList
+		expected State
+	}{
+		{list(STATE_UP, STATE_UP), STATE_UP},
+		{list(STATE_UP, STATE_DOWN), STATE_DEGRADED},
+		{list(STATE_DOWN, STATE_DOWN), STATE_DOWN},
+		{list(STATE_UP, STATE_UNKNOWN), STATE_UNKNOWN},
+		{list(STATE_DOWN, STATE_UNKNOWN), STATE_DEGRADED},
+		{list(), STATE_UNKNOWN},
+		{list(STATE_PAUSED, STATE_PAUSED), STATE_UNKNOWN},
+		{list(STATE_PAUSED, STATE_UP), STATE_UP},
+	}
+
+	for _, c := range cases {
+		actual := c.list.State()
+		if actual != c.expected {
+			t.Fatalf("expected %s, got %s", c.expected, actual)
+			return
+		}
+	}
+}
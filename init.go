@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/thekhanj/avail/common"
+	"github.com/thekhanj/avail/config"
+	"gopkg.in/yaml.v3"
+)
+
+// INIT_PROBES is how many URLs avail init probes at once.
+const INIT_PROBES = 8
+
+// CERT_EXPIRY_WARNING is how soon a certificate must expire for avail init
+// to warn about it.
+const CERT_EXPIRY_WARNING = 14 * 24 * time.Hour
+
+// InitConfig is the config written by avail init.
+type InitConfig struct {
+	Schema string     `json:"$schema" yaml:"$schema" toml:"$schema"`
+	Sites  []InitSite `json:"sites" yaml:"sites" toml:"sites"`
+}
+
+// InitSite is a site suggested by SuggestSite, with the notes explaining
+// the suggestion.
+type InitSite struct {
+	Title    string            `json:"title" yaml:"title" toml:"title"`
+	Url      string            `json:"url" yaml:"url" toml:"url"`
+	Group    string            `json:"group,omitempty" yaml:"group,omitempty" toml:"group,omitempty"`
+	Interval string            `json:"interval" yaml:"interval" toml:"interval"`
+	Timeout  string            `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Proxy    string            `json:"proxy,omitempty" yaml:"proxy,omitempty" toml:"proxy,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	Check    *InitCheck        `json:"check,omitempty" yaml:"check,omitempty" toml:"check,omitempty"`
+
+	Notes []string `json:"-" yaml:"-" toml:"-"`
+}
+
+type InitCheck struct {
+	Type   string `json:"type" yaml:"type" toml:"type"`
+	Script string `json:"script" yaml:"script" toml:"script"`
+}
+
+var initUrl = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// ReadInitUrls extracts the http(s) URLs of a text, e.g. one URL per line
+// or a browser's exported bookmarks. Each URL is listed once.
+func ReadInitUrls(r io.Reader) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0)
+	for _, u := range initUrl.FindAllString(string(b), -1) {
+		if !slices.Contains(ret, u) {
+			ret = append(ret, u)
+		}
+	}
+	return ret, nil
+}
+
+// promptLines reads lines, prompting for each, until an empty one.
+func promptLines(in *bufio.Reader, prompt string) string {
+	var b strings.Builder
+	for {
+		fmt.Fprint(os.Stderr, prompt)
+		line, err := in.ReadString('\n')
+		if strings.TrimSpace(line) == "" || err != nil {
+			b.WriteString(line)
+			return b.String()
+		}
+		b.WriteString(line)
+	}
+}
+
+// SuggestSite probes a URL once and suggests how to monitor it:
+//   - a redirect within the same host is followed, so the site is checked
+//     without the extra round trip,
+//   - JSON health endpoints reporting a status are checked for it and
+//     checked more often than pages,
+//   - the 401 or 403 of an endpoint requiring credentials is expected by a
+//     check, as it would otherwise be considered down,
+//   - the timeout leaves room for ten times the observed latency.
+func SuggestSite(ctx context.Context, client *http.Client, rawUrl string) InitSite {
+	ret := InitSite{Url: rawUrl, Interval: "1m", Timeout: "30s"}
+	note := func(format string, args ...any) {
+		ret.Notes = append(ret.Notes, fmt.Sprintf(format, args...))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
+	if err != nil {
+		note("invalid url: %v", err)
+		return ret
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		note("probe failed, keeping the defaults: %v", config.Redact(err.Error()))
+		return ret
+	}
+	defer res.Body.Close()
+
+	ret.Timeout = suggestTimeout(latency).String()
+
+	final := res.Request.URL
+	if final.String() != rawUrl {
+		if sameHost(req.URL, final) {
+			ret.Url = final.String()
+			note("redirects to %s, which is monitored instead", final)
+		} else {
+			note("redirects to %s on another host", final)
+		}
+	}
+
+	if res.TLS != nil && len(res.TLS.PeerCertificates) != 0 {
+		expiry := res.TLS.PeerCertificates[0].NotAfter
+		left := time.Until(expiry)
+		if left < CERT_EXPIRY_WARNING {
+			note("TLS certificate expires soon, on %s", expiry.Format(time.DateOnly))
+		} else {
+			note("TLS certificate valid until %s", expiry.Format(time.DateOnly))
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	ok := 200 <= res.StatusCode && res.StatusCode < 300
+
+	if ok && strings.Contains(res.Header.Get("Content-Type"), "json") {
+		key, value, found := healthStatus(body)
+		if found {
+			ret.Interval = "30s"
+			ret.Check = CheckConditions{
+				Matches: []string{jsonFieldPattern(key, value, true)},
+			}.Check()
+			note("health endpoint reporting %s \"%s\", which is checked", key, value)
+		}
+	}
+
+	switch {
+	case ok:
+	case res.StatusCode == http.StatusUnauthorized ||
+		res.StatusCode == http.StatusForbidden:
+		ret.Check = CheckConditions{
+			Statuses: &StatusSet{Codes: []int{res.StatusCode}},
+		}.Check()
+		note("responded with %s, which is expected by the check", res.Status)
+	case res.StatusCode >= 500:
+		note("responded with %s, it may be down right now", res.Status)
+	default:
+		note("responded with %s, the url may be wrong", res.Status)
+	}
+
+	return ret
+}
+
+// suggestTimeout leaves room for ten times the latency, in whole seconds,
+// between 5s and 30s.
+func suggestTimeout(latency time.Duration) time.Duration {
+	seconds := math.Ceil((10 * latency).Seconds())
+	return time.Duration(min(max(seconds, 5), 30)) * time.Second
+}
+
+func sameHost(a, b *url.URL) bool {
+	host := func(u *url.URL) string {
+		return strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return host(a) == host(b)
+}
+
+// healthStatus finds the status reported by a JSON health endpoint, e.g.
+// {"status": "ok"}.
+func healthStatus(body []byte) (string, string, bool) {
+	var fields map[string]any
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return "", "", false
+	}
+
+	for _, key := range []string{"status", "Status", "state", "health"} {
+		value, ok := fields[key].(string)
+		// quotes are escaped in the body, which the pattern does not match
+		if ok && value != "" && !strings.ContainsAny(value, `'"`) {
+			return key, value, true
+		}
+	}
+	return "", "", false
+}
+
+// SuggestSites probes the URLs concurrently, reporting each site to done
+// as it is suggested. The sites keep the order of the URLs.
+func SuggestSites(
+	ctx context.Context, client *http.Client, urls []string,
+	done func(site InitSite),
+) []InitSite {
+	ret := make([]InitSite, len(urls))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, INIT_PROBES)
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			site := SuggestSite(ctx, client, u)
+			mu.Lock()
+			defer mu.Unlock()
+
+			ret[i] = site
+			if done != nil {
+				done(site)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ret
+}
+
+// SuggestTitle derives a title from the URL's host and path, e.g.
+// example.com-api-health, that is not in taken.
+func SuggestTitle(rawUrl string, taken []string) string {
+	title := rawUrl
+	u, err := url.Parse(rawUrl)
+	if err == nil && u.Host != "" {
+		title = strings.TrimPrefix(u.Hostname(), "www.")
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment != "" {
+				title += "-" + segment
+			}
+		}
+	}
+	return UniqueTitle(title, taken)
+}
+
+// UniqueTitle makes a title name a directory, replacing '/' and NUL, and
+// appends -2, -3, … until it is not in taken.
+func UniqueTitle(title string, taken []string) string {
+	title = strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '-'
+		}
+		return r
+	}, title)
+	if title == "" || title == "." || title == ".." {
+		title = "site"
+	}
+
+	ret := title
+	for i := 2; slices.Contains(taken, ret); i++ {
+		ret = title + "-" + strconv.Itoa(i)
+	}
+	return ret
+}
+
+// NewInitConfig creates the config of the sites, pointing to the schema of
+// this version.
+func NewInitConfig(sites []InitSite) *InitConfig {
+	return &InitConfig{
+		Schema: common.GetJsonSchemaAddress(VERSION),
+		Sites:  sites,
+	}
+}
+
+// Marshal encodes the config in the format of path's extension. The result
+// is checked to be a valid config.
+func (this *InitConfig) Marshal(path string) ([]byte, error) {
+	format := config.DetectFormat(path, nil)
+
+	var b []byte
+	var err error
+	switch format {
+	case config.FORMAT_YAML:
+		b, err = yaml.Marshal(this)
+	case config.FORMAT_TOML:
+		b, err = toml.Marshal(this)
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(this)
+		b = buf.Bytes()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := config.ToJson(format, b)
+	if err != nil {
+		return nil, err
+	}
+	var c config.Config
+	err = c.UnmarshalJSON(j)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return b, nil
+}
+
+// Write writes the config to path, refusing to replace an existing file
+// unless force is set.
+func (this *InitConfig) Write(path string, force bool) error {
+	b, err := this.Marshal(path)
+	if err != nil {
+		return err
+	}
+	return writeNewFile(path, b, force)
+}
+
+// writeNewFile writes b to path, refusing to replace an existing file
+// unless force is set.
+func writeNewFile(path string, b []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists, use -f to replace it", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
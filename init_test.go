@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestSuggestSites(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "ok", "version": "1.2"}`))
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	sites := SuggestSites(t.Context(), s.Client(), []string{
+		s.URL + "/health", s.URL + "/old", s.URL + "/api",
+	}, nil)
+
+	health := sites[0]
+	if health.Interval != "30s" || health.Check == nil ||
+		!strings.Contains(health.Check.Script, `"status" *: *"ok"`) {
+		t.Fatalf("expected the health status to be checked: %+v", health)
+		return
+	}
+	if sites[1].Url != s.URL+"/new" || sites[1].Check != nil {
+		t.Fatalf("expected the redirect to be followed: %+v", sites[1])
+		return
+	}
+	if sites[2].Check == nil || !strings.Contains(sites[2].Check.Script, "= 401 ]") {
+		t.Fatalf("expected the status to be expected: %+v", sites[2])
+		return
+	}
+
+	titles := make([]string, 0)
+	for i := range sites {
+		sites[i].Title = SuggestTitle(sites[i].Url, titles)
+		titles = append(titles, sites[i].Title)
+	}
+	if titles[0] != "127.0.0.1-health" {
+		t.Fatalf("unexpected title: %s", titles[0])
+		return
+	}
+
+	for _, name := range []string{"avail.json", "avail.yaml", "avail.toml"} {
+		path := filepath.Join(t.TempDir(), name)
+		err := NewInitConfig(sites).Write(path, false)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		cfg, err := config.ReadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if len(cfg.Sites) != 3 || cfg.Sites[0].Interval != "30s" {
+			t.Fatalf("%s: unexpected sites: %+v", name, cfg.Sites)
+			return
+		}
+
+		err = NewInitConfig(sites).Write(path, false)
+		if err == nil {
+			t.Fatal("expected an existing config to be kept")
+			return
+		}
+	}
+}
+
+func TestReadInitUrls(t *testing.T) {
+	urls, err := ReadInitUrls(strings.NewReader(`<DL><p>
+<DT><A HREF="https://example.com/" ADD_DATE="1">Example</A>
+<DT><A HREF="http://example.org/status">Status</A>
+</DL>
+https://example.com/
+`))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if strings.Join(urls, " ") != "https://example.com/ http://example.org/status" {
+		t.Fatalf("unexpected urls: %v", urls)
+		return
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/thekhanj/avail/common"
+)
+
+// ErrStopTimeout is returned by Stop if the daemon did not exit in time.
+var ErrStopTimeout = errors.New("timed out waiting for the daemon to exit")
+
+// Stop sends SIGTERM to the daemon and waits for it to exit and remove its
+// PID file (if known). With kill set, the daemon is killed if it does not
+// exit within timeout, and the files it leaves behind are removed.
+func Stop(pid int, pidFile string, timeout time.Duration, kill bool) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	err = proc.Signal(syscall.SIGTERM)
+	if err != nil {
+		return err
+	}
+
+	if waitExit(pid, pidFile, timeout) {
+		return nil
+	}
+	if !kill {
+		return ErrStopTimeout
+	}
+
+	err = proc.Signal(syscall.SIGKILL)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	if !waitExit(pid, "", timeout) {
+		return ErrStopTimeout
+	}
+
+	if pidFile != "" {
+		err = os.Remove(pidFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.RemoveAll(common.GetPidVarDir(pid))
+}
+
+// waitExit waits until the process is gone and its PID file is removed.
+func waitExit(pid int, pidFile string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		done := !common.ProcessExists(pid)
+		if done && pidFile != "" {
+			_, err := os.Stat(pidFile)
+			done = errors.Is(err, os.ErrNotExist)
+		}
+		if done {
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Daemonize starts "avail run" with the given config in the background,
+// detached from the terminal and logging to logFile. It returns once the
+// daemon wrote its PID file, or fails if the daemon exits before that.
+func Daemonize(cfgPath, pidFile, logFile string, timeout time.Duration) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cfgPath, err = filepath.Abs(cfgPath)
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(logFile), 0755)
+	if err != nil {
+		return 0, err
+	}
+	log, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(self, "run", "-c", cfgPath)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = detachedProcAttr()
+
+	err = cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return 0, fmt.Errorf("daemon failed to start (%v), see %s", err, logFile)
+		case <-deadline:
+			return pid, fmt.Errorf("daemon did not write its PID file in time, see %s", logFile)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		running, err := common.GetPid(pidFile)
+		if err == nil && running == pid {
+			return pid, nil
+		}
+	}
+}
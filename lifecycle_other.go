@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/thekhanj/avail/config"
+)
+
+// NewLogger creates the daemon's logger. Messages about a site carry the
+// "site" and "url" fields and the result of checks "latency_ms", "state"
+// and "error".
+func NewLogger(w io.Writer, cfg *config.Log) (*slog.Logger, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(cfg.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if cfg.Format == config.LogFormatJson {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
+}
+
+func newSiteLog(title, url string) *slog.Logger {
+	return slog.Default().With("site", title, "url", url)
+}
+
+// redactAttr hides the secrets interpolated into the config from a logged
+// value.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, config.Redact(v.String()))
+	case slog.KindAny:
+		err, ok := v.Any().(error)
+		if ok {
+			return slog.String(a.Key, config.Redact(err.Error()))
+		}
+	}
+
+	return a
+}
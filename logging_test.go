@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestLogTransitionsOnly(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, &config.Log{
+		Format: config.LogFormatJson,
+		Level:  config.LogLevelInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	ping, err := NewPing(
+		"local", "http://127.0.0.1",
+		PingWithPath(t.TempDir()),
+		PingWithLog(logger.With("site", "local")),
+		PingWithTransitionsOnly(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	ping.update(5, true, nil)
+	ping.update(5, true, nil)
+	ping.update(7, false, errors.New("refused"))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected only the 2 transitions to be logged, got %s", buf.String())
+		return
+	}
+
+	var entry map[string]any
+	err = json.Unmarshal(lines[1], &entry)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if entry["msg"] != "state changed" || entry["level"] != "WARN" ||
+		entry["site"] != "local" || entry["state"] != "down" ||
+		entry["previous"] != "up" || entry["latency_ms"] != 7.0 ||
+		entry["error"] != "refused" {
+		t.Fatalf("unexpected entry: %s", lines[1])
+		return
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -16,7 +21,7 @@ import (
 
 type PingOption = func(ping *Ping)
 
-func NewPingFromConfig(cfg *config.Ping) (*Ping, error) {
+func NewPingFromConfig(cfg *config.Ping, opts ...PingOption) (*Ping, error) {
 	interval, err := time.ParseDuration(string(cfg.Interval))
 	if err != nil {
 		return nil, err
@@ -38,17 +43,28 @@ func NewPingFromConfig(cfg *config.Ping) (*Ping, error) {
 	if err != nil {
 		return nil, err
 	}
-	check, err := NewCheckFromConfig(checkCfg)
+	check, err := NewCheckFromConfig(
+		checkCfg, newSiteLog(cfg.Title, config.Redact(cfg.Url)),
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	group := ""
+	if cfg.Group != nil {
+		group = string(*cfg.Group)
+	}
+
 	return NewPing(
 		cfg.Title, cfg.Url,
-		PingWithInterval(interval),
-		PingWithTimeout(timeout),
-		PingWithClient(client),
-		PingWithCheck(check),
+		append([]PingOption{
+			PingWithInterval(interval),
+			PingWithTimeout(timeout),
+			PingWithClient(client),
+			PingWithCheck(check),
+			PingWithTags(cfg.Tags),
+			PingWithGroup(group),
+		}, opts...)...,
 	)
 }
 
@@ -57,14 +73,17 @@ func NewPing(title, url string, opts ...PingOption) (*Ping, error) {
 		url:   url,
 		title: title,
 
-		log:      log.New(os.Stderr, title+": ", 0),
+		log:      newSiteLog(title, config.Redact(url)),
 		interval: time.Second * 5,
 		timeout:  time.Second * 30,
 		path:     filepath.Join(common.GetPidVarDir(syscall.Getpid()), title),
 		client:   http.DefaultClient,
 
 		ch:         make(chan struct{}),
+		trigger:    make(chan struct{}, 1),
+		checked:    make(chan struct{}),
 		wasHealthy: false,
+		stats:      NewStats(),
 
 		check:     &StatusCheck{},
 		firstTime: true,
@@ -74,15 +93,9 @@ func NewPing(title, url string, opts ...PingOption) (*Ping, error) {
 		o(base)
 	}
 
-	stat, err := os.Stat(base.path)
-	if err == nil && !stat.IsDir() {
-		return nil, fmt.Errorf("not a directory: %s", base.path)
-	}
+	_, err := neturl.Parse(url)
 	if err != nil {
-		err = os.MkdirAll(base.path, 0755)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	return base, nil
@@ -106,12 +119,20 @@ func PingWithTimeout(timeout time.Duration) PingOption {
 	}
 }
 
-func PingWithLog(log *log.Logger) PingOption {
+func PingWithLog(log *slog.Logger) PingOption {
 	return func(ping *Ping) {
 		ping.log = log
 	}
 }
 
+// PingWithTransitionsOnly logs the result of each check at the debug
+// level, leaving only state transitions at the info level.
+func PingWithTransitionsOnly(transitionsOnly bool) PingOption {
+	return func(ping *Ping) {
+		ping.transitionsOnly = transitionsOnly
+	}
+}
+
 func PingWithPath(path string) PingOption {
 	return func(ping *Ping) {
 		ping.path = path
@@ -124,113 +145,502 @@ func PingWithClient(client *http.Client) PingOption {
 	}
 }
 
+// PingWithTags sets the tags the site is selected by, see Selector.
+func PingWithTags(tags map[string]string) PingOption {
+	return func(ping *Ping) {
+		ping.tags = tags
+	}
+}
+
+// PingWithGroup sets the group the site is shown in and selected by.
+func PingWithGroup(group string) PingOption {
+	return func(ping *Ping) {
+		ping.group = group
+	}
+}
+
 type Ping struct {
 	url   string
 	path  string
 	title string
+	tags  map[string]string
+	group string
 
 	interval time.Duration
 	timeout  time.Duration
 	client   *http.Client
 
-	log *log.Logger
+	log             *slog.Logger
+	transitionsOnly bool
 
-	wasHealthy bool
-	ch         chan struct{}
+	ch      chan struct{}
+	trigger chan struct{}
+	paused  atomic.Bool
+	// unix nanoseconds of the last iteration of Run, zero if not running
+	heartbeat atomic.Int64
+
+	check Check
 
-	check     Check
-	firstTime bool
+	// guards the state below, which is updated after each check
+	mu         sync.Mutex
+	firstTime  bool
+	wasHealthy bool
+	latency    int64
+	lastErr    string
+	since      time.Time
+	stats      *Stats
+	// start of the last finished check, checked is closed when it finishes
+	started time.Time
+	checked chan struct{}
+	// automatically resumes the site, see PauseFor
+	resumeTimer *time.Timer
+	pausedUntil time.Time
 }
 
 func (this *Ping) Run(ctx context.Context) {
+	err := this.createDir()
+	if err != nil {
+		this.log.Error("creating directory failed", "error", err)
+		return
+	}
 	defer this.cleanup()
 
-	this.log.Printf(
-		"running HTTP ping on \"%s\" (path: \"%s\")...\n",
-		this.url, this.path,
-	)
-	defer this.log.Printf(
-		"running HTTP ping on \"%s\" (path: \"%s\") done\n",
-		this.url, this.path,
-	)
+	this.log.Info("started", "path", this.path)
+	defer this.log.Info("stopped")
+
+	this.writeFile("url", this.Url()+"\n")
+	this.writeFile("interval", this.interval.String()+"\n")
+	if this.group != "" {
+		this.writeFile("group", this.group+"\n")
+	}
+	if len(this.tags) != 0 {
+		this.writeFile("tags", formatTags(this.tags)+"\n")
+	}
+	this.writeRestored()
+
+	this.heartbeat.Store(time.Now().UnixNano())
+	defer this.heartbeat.Store(0)
 
 	go this.schedule(ctx)
 
-	for range this.ch {
-		err := this.checkAvailability(ctx)
-		if err != nil {
-			this.log.Println(err)
+	for {
+		select {
+		case _, ok := <-this.ch:
+			if !ok {
+				return
+			}
+			this.heartbeat.Store(time.Now().UnixNano())
+			if this.paused.Load() {
+				continue
+			}
+			// don't double up right after a triggered check
+			if time.Since(this.lastCheck()) < this.interval/2 {
+				continue
+			}
+		case <-this.trigger:
+			this.heartbeat.Store(time.Now().UnixNano())
 		}
+
+		start := time.Now()
+		this.checkAvailability(ctx)
+		this.checkDone(start)
 	}
 }
 
-func (this *Ping) cleanup() {
-	err := os.RemoveAll(this.path)
-	if err != nil {
-		this.log.Println(err)
+// Alive reports whether Run is making progress, i.e. it went through its
+// loop within the last interval plus timeout. A site that is not running is
+// considered alive.
+func (this *Ping) Alive(now time.Time) bool {
+	heartbeat := this.heartbeat.Load()
+	return heartbeat == 0 ||
+		now.Sub(time.Unix(0, heartbeat)) <= this.interval+this.timeout
+}
+
+// CheckNow triggers a check and waits for its result. A check that is
+// already running is not waited for, as it may have started before e.g. a
+// fix was deployed.
+func (this *Ping) CheckNow(ctx context.Context) (SiteStatus, error) {
+	requested := time.Now()
+	this.Trigger()
+
+	for {
+		this.mu.Lock()
+		started := this.started
+		checked := this.checked
+		this.mu.Unlock()
+
+		if !started.Before(requested) {
+			return this.Status(), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return SiteStatus{}, ctx.Err()
+		case <-checked:
+		}
 	}
 }
 
-func (this *Ping) checkAvailability(ctx context.Context) error {
-	reqCtx, cancel := context.WithTimeout(ctx, this.timeout)
-	defer cancel()
+func (this *Ping) lastCheck() time.Time {
+	this.mu.Lock()
+	defer this.mu.Unlock()
 
-	req, err := http.NewRequestWithContext(reqCtx, "GET", this.url, nil)
-	if err != nil {
-		this.update(0, false)
-		return err
+	return this.started
+}
+
+// checkDone wakes up the CheckNow calls waiting for the check started at
+// start.
+func (this *Ping) checkDone(start time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.started = start
+	close(this.checked)
+	this.checked = make(chan struct{})
+}
+
+// Trigger runs a check as soon as possible, regardless of the schedule and
+// of the site being paused. Triggers received while a check is already
+// pending are dropped.
+func (this *Ping) Trigger() {
+	select {
+	case this.trigger <- struct{}{}:
+	default:
 	}
+}
 
-	before := time.Now()
-	res, err := this.client.Do(req)
-	after := time.Now()
-	latency := after.UnixMilli() - before.UnixMilli()
+// HandleRequests applies the pending requests sent via SendRequest.
+func (this *Ping) HandleRequests() {
+	requests, err := ReadRequests(this.path)
 	if err != nil {
-		this.update(latency, false)
-		return err
+		this.log.Error("reading requests failed", "error", err)
+		return
+	}
+
+	for _, r := range requests {
+		err := this.Request(r)
+		if err != nil {
+			this.log.Warn("invalid request", "error", err)
+		}
+	}
+}
+
+// Request applies a single request (see REQUEST_CHECK and friends). Pause
+// requests may be followed by a duration after which the site is resumed,
+// e.g. "pause 30m".
+func (this *Ping) Request(request string) error {
+	name, arg, _ := strings.Cut(request, " ")
+	if arg != "" && name != REQUEST_PAUSE {
+		return fmt.Errorf("unexpected argument to \"%s\" request: %s", name, arg)
 	}
 
-	isUp, err := this.check.IsUp(res)
-	if err != nil || !isUp {
-		this.update(latency, false)
-		return err
+	switch name {
+	case REQUEST_CHECK:
+		this.Trigger()
+	case REQUEST_PAUSE:
+		var d time.Duration
+		if arg != "" {
+			var err error
+			d, err = time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid pause duration \"%s\"", arg)
+			}
+		}
+		this.PauseFor(d)
+	case REQUEST_RESUME:
+		this.Resume()
+	default:
+		return fmt.Errorf("invalid request \"%s\"", request)
 	}
 
-	this.update(latency, true)
 	return nil
 }
 
-func (this *Ping) update(latency int64, health bool) {
-	if health {
-		this.log.Printf("GET request succeeded (latency: %d ms)\n", latency)
+func (this *Ping) Pause() {
+	this.PauseFor(0)
+}
+
+// PauseFor stops the scheduled checks of the site until it is resumed, or
+// until d has passed if it is not zero. Pausing again replaces the previous
+// duration.
+func (this *Ping) PauseFor(d time.Duration) {
+	var until time.Time
+	if d != 0 {
+		until = time.Now().Add(d)
+	}
+
+	this.mu.Lock()
+	this.pauseUntil(until)
+	content := this.pausedContent()
+	this.mu.Unlock()
+
+	if d != 0 {
+		this.log.Info("paused", "for", d.String())
 	} else {
-		this.log.Printf("GET request failed (latency: %d ms)\n", latency)
+		this.log.Info("paused")
+	}
+	this.writeFile("paused", content)
+}
+
+// pauseUntil pauses the site until the given time, or indefinitely if it is
+// zero. It must be called with mu held.
+func (this *Ping) pauseUntil(until time.Time) {
+	this.stopResumeTimer()
+	this.pausedUntil = until
+	this.paused.Store(true)
+
+	if until.IsZero() {
+		return
 	}
 
-	err := os.WriteFile(
-		filepath.Join(this.path, "latency"),
-		[]byte(fmt.Sprintf("%d\n", latency)),
-		0644,
-	)
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(until), func() {
+		this.mu.Lock()
+		current := this.resumeTimer == timer
+		this.mu.Unlock()
+
+		// a newer pause or resume took over
+		if current {
+			this.Resume()
+		}
+	})
+	this.resumeTimer = timer
+}
+
+// pausedContent returns the content of the "paused" file. It must be called
+// with mu held.
+func (this *Ping) pausedContent() string {
+	if this.pausedUntil.IsZero() {
+		return "1\n"
+	}
+	return this.pausedUntil.Format(time.RFC3339) + "\n"
+}
+
+func (this *Ping) Resume() {
+	this.mu.Lock()
+	this.stopResumeTimer()
+	this.pausedUntil = time.Time{}
+	this.mu.Unlock()
+
+	this.log.Info("resumed")
+	this.paused.Store(false)
+
+	err := os.Remove(filepath.Join(this.path, "paused"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		this.log.Error("removing file failed", "error", err)
+	}
+}
+
+// stopResumeTimer cancels the pending automatic resume, if any. It must be
+// called with mu held.
+func (this *Ping) stopResumeTimer() {
+	if this.resumeTimer != nil {
+		this.resumeTimer.Stop()
+		this.resumeTimer = nil
+	}
+}
+
+func (this *Ping) createDir() error {
+	stat, err := os.Stat(this.path)
+	if err == nil && !stat.IsDir() {
+		return fmt.Errorf("not a directory: %s", this.path)
+	}
 	if err != nil {
-		this.log.Println(err)
+		err = os.MkdirAll(this.path, 0755)
+		if err != nil {
+			return err
+		}
 	}
 
-	if this.firstTime || this.wasHealthy != health {
+	return CreateRequestFile(this.path)
+}
+
+func (this *Ping) cleanup() {
+	this.mu.Lock()
+	this.stopResumeTimer()
+	this.mu.Unlock()
+
+	err := os.RemoveAll(this.path)
+	if err != nil {
+		this.log.Warn("removing directory failed", "error", err)
+	}
+}
+
+func (this *Ping) checkAvailability(ctx context.Context) {
+	res := this.Probe(ctx)
+	this.update(res.latency, res.Health, res.err)
+}
+
+func (this *Ping) update(latency int64, health bool, err error) {
+	state := STATE_DOWN
+	if health {
+		state = STATE_UP
+	}
+	lastErr := ""
+	if err != nil {
+		lastErr = config.Redact(err.Error())
+	}
+
+	attrs := []any{"latency_ms", latency, "state", state}
+	if err != nil {
+		attrs = append(attrs, "error", lastErr)
+	}
+
+	msg, level := "check succeeded", slog.LevelInfo
+	if !health {
+		msg, level = "check failed", slog.LevelWarn
+	}
+	if this.transitionsOnly {
+		level = slog.LevelDebug
+	}
+	this.log.Log(context.Background(), level, msg, attrs...)
+
+	now := time.Now()
+
+	this.mu.Lock()
+	previous := STATE_UNKNOWN
+	if !this.firstTime {
+		previous = STATE_DOWN
+		if this.wasHealthy {
+			previous = STATE_UP
+		}
+	}
+	changed := this.firstTime || this.wasHealthy != health
+	if changed {
 		this.firstTime = false
+		this.wasHealthy = health
+		this.since = now
+	}
+	this.latency = latency
+	this.lastErr = lastErr
+	this.stats.Record(Sample{Time: now, Latency: latency, Health: health}, lastErr)
+	history := this.stats.History()
+	this.mu.Unlock()
+
+	this.writeFile("latency", fmt.Sprintf("%d\n", latency))
+	this.writeHistory(history)
+
+	if lastErr != "" {
+		lastErr += "\n"
+	}
+	this.writeFile("error", lastErr)
+
+	if changed {
+		level := slog.LevelInfo
+		if !health {
+			level = slog.LevelWarn
+		}
+		this.log.Log(
+			context.Background(), level, "state changed",
+			append(attrs, "previous", previous)...,
+		)
+
 		content := "0\n"
 		if health {
 			content = "1\n"
 		}
 
-		err := os.WriteFile(
-			filepath.Join(this.path, "health"), []byte(content), 0644,
-		)
-		if err != nil {
-			this.log.Println(err)
+		this.writeFile("health", content)
+		this.writeFile("since", now.Format(time.RFC3339)+"\n")
+	}
+}
+
+// Status returns the current state of the site, as seen by the daemon.
+func (this *Ping) Status() SiteStatus {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ret := SiteStatus{
+		SiteEntry: SiteEntry{
+			Title:    this.title,
+			Url:      this.Url(),
+			Interval: this.interval.String(),
+			Group:    this.group,
+			Tags:     this.tags,
+		},
+		State:   STATE_UNKNOWN,
+		Latency: this.latency,
+		Health:  this.wasHealthy,
+		Error:   this.lastErr,
+		Since:   this.since,
+	}
+
+	if !this.firstTime {
+		ret.State = STATE_DOWN
+		if this.wasHealthy {
+			ret.State = STATE_UP
 		}
+		ret.SinceChange = time.Since(this.since).Round(time.Second).String()
+	}
+	if this.paused.Load() {
+		ret.State = STATE_PAUSED
+	}
 
-		this.wasHealthy = health
+	return ret
+}
+
+func (this *Ping) Title() string {
+	return this.title
+}
+
+// Url returns the URL of the site, with the secrets interpolated into it
+// redacted.
+func (this *Ping) Url() string {
+	return config.Redact(this.url)
+}
+
+// History returns the most recent samples, oldest first.
+func (this *Ping) History() []Sample {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.stats.History()
+}
+
+// Days returns the uptime of the last n days, see Stats.Days.
+func (this *Ping) Days(n int) []DayUptime {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.stats.Days(time.Now(), n)
+}
+
+// Uptime returns the uptime during the given window, see Stats.Uptime.
+func (this *Ping) Uptime(window time.Duration) (float64, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.stats.Uptime(time.Now(), window)
+}
+
+func (this *Ping) Incidents() []Incident {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.stats.Incidents()
+}
+
+func (this *Ping) writeHistory(history []Sample) {
+	var b strings.Builder
+	for _, s := range history {
+		b.WriteString(s.String())
+		b.WriteByte('\n')
+	}
+	this.writeFile("history", b.String())
+}
+
+// writeFile replaces a file atomically, so readers never see it half
+// written.
+func (this *Ping) writeFile(name, content string) {
+	path := filepath.Join(this.path, name)
+	tmp := path + ".tmp"
+
+	err := os.WriteFile(tmp, []byte(content), 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		this.log.Error("writing file failed", "error", err)
 	}
 }
 
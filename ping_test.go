@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestPing(t *testing.T) {
-	s, err := NewPing("google", "https://google.com")
+	s, err := NewPing(
+		"google", "https://google.com",
+		PingWithPath(filepath.Join(t.TempDir(), "google")),
+	)
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -18,3 +25,125 @@ func TestPing(t *testing.T) {
 
 	s.Run(ctx)
 }
+
+func TestPingCheckNow(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+		},
+	))
+	defer srv.Close()
+
+	s, err := NewPing(
+		"local", srv.URL,
+		PingWithInterval(time.Hour),
+		PingWithPath(filepath.Join(t.TempDir(), "local")),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for i := range 2 {
+		status, err := s.CheckNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if status.State != STATE_UP {
+			t.Fatalf("expected site to be up, got %s", status.State)
+			return
+		}
+		// the first scheduled check may or may not be merged into the first
+		// triggered one
+		if n := requests.Load(); n < int32(i+1) || n > int32(i+2) {
+			t.Fatalf("unexpected number of checks: %d", n)
+			return
+		}
+	}
+}
+
+func TestPingProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/down" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		},
+	))
+	defer srv.Close()
+
+	for _, path := range []string{"/", "/down"} {
+		s, err := NewPing("local", srv.URL+path)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		res := s.Probe(t.Context())
+		if res.Health != (path == "/") {
+			t.Fatalf("%s: unexpected health: %v (error: %s)", path, res.Health, res.Error)
+			return
+		}
+		if res.FirstByte == 0 || res.Total < res.FirstByte {
+			t.Fatalf("%s: unexpected timings: %+v", path, res)
+			return
+		}
+	}
+}
+
+func TestPingPauseFor(t *testing.T) {
+	s, err := NewPing("local", "http://localhost", PingWithPath(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	for _, r := range []string{"pause 0s", "pause soon", "check 1m", "stop"} {
+		if s.Request(r) == nil {
+			t.Fatalf("expected request \"%s\" to be rejected", r)
+			return
+		}
+	}
+
+	err = s.Request("pause 50ms")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !s.paused.Load() {
+		t.Fatal("expected site to be paused")
+		return
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s.paused.Load() {
+		t.Fatal("expected site to be resumed after the pause expired")
+		return
+	}
+
+	err = s.Request("pause 50ms")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	s.Pause()
+
+	time.Sleep(100 * time.Millisecond)
+	if !s.paused.Load() {
+		t.Fatal("indefinite pause must replace the timed one")
+		return
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+// Milliseconds is a duration written in milliseconds, like the latency of
+// sites, with microsecond precision, e.g. 215.131.
+type Milliseconds time.Duration
+
+func (this Milliseconds) Float() float64 {
+	return float64(time.Duration(this).Round(time.Microsecond)) / float64(time.Millisecond)
+}
+
+func (this Milliseconds) String() string {
+	return strconv.FormatFloat(this.Float(), 'f', -1, 64)
+}
+
+func (this Milliseconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.Float())
+}
+
+func (this Milliseconds) MarshalYAML() (any, error) {
+	return this.Float(), nil
+}
+
+// ProbeResult is the detailed outcome of a single check. Phases that did
+// not happen (e.g. TLS for plain HTTP, or DNS for a reused connection) are
+// zero.
+type ProbeResult struct {
+	Title      string       `json:"title"`
+	Url        string       `json:"url"`
+	Status     string       `json:"status,omitempty"`
+	StatusCode int          `json:"statusCode,omitempty"`
+	Dns        Milliseconds `json:"dns"`
+	Connect    Milliseconds `json:"connect"`
+	Tls        Milliseconds `json:"tls"`
+	FirstByte  Milliseconds `json:"firstByte"`
+	Total      Milliseconds `json:"total"`
+	Health     bool         `json:"health"`
+	Error      string       `json:"error,omitempty"`
+
+	latency int64
+	err     error
+}
+
+var ProbeResultHeader = []string{
+	"title", "url", "status", "statusCode",
+	"dns", "connect", "tls", "firstByte", "total",
+	"health", "error",
+}
+
+func (this ProbeResult) Row() []string {
+	return []string{
+		this.Title,
+		this.Url,
+		this.Status,
+		strconv.Itoa(this.StatusCode),
+		this.Dns.String(),
+		this.Connect.String(),
+		this.Tls.String(),
+		this.FirstByte.String(),
+		this.Total.String(),
+		strconv.FormatBool(this.Health),
+		this.Error,
+	}
+}
+
+func (this ProbeResult) String() string {
+	phase := func(d Milliseconds) string {
+		if d == 0 {
+			return "-"
+		}
+		return time.Duration(d).Round(time.Microsecond).String()
+	}
+
+	status := this.Status
+	if status == "" {
+		status = "-"
+	}
+	verdict := "passed"
+	if !this.Health {
+		verdict = "failed"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "url:         %s\n", this.Url)
+	fmt.Fprintf(&b, "status:      %s\n", status)
+	fmt.Fprintf(&b, "dns:         %s\n", phase(this.Dns))
+	fmt.Fprintf(&b, "connect:     %s\n", phase(this.Connect))
+	fmt.Fprintf(&b, "tls:         %s\n", phase(this.Tls))
+	fmt.Fprintf(&b, "first byte:  %s\n", phase(this.FirstByte))
+	fmt.Fprintf(&b, "total:       %s\n", phase(this.Total))
+	fmt.Fprintf(&b, "check:       %s", verdict)
+	if this.Error != "" {
+		fmt.Fprintf(&b, "\nerror:       %s", this.Error)
+	}
+
+	return b.String()
+}
+
+// probeTrace collects the timing of the phases of a request. Callbacks may
+// run concurrently, e.g. when dialing several addresses.
+type probeTrace struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+}
+
+func (this *probeTrace) ClientTrace() *httptrace.ClientTrace {
+	now := func(t *time.Time) {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+
+		*t = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&this.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(&this.dnsDone) },
+		ConnectStart: func(string, string) {
+			this.mu.Lock()
+			defer this.mu.Unlock()
+
+			if this.connectStart.IsZero() {
+				this.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				now(&this.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { now(&this.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			now(&this.tlsDone)
+		},
+		GotFirstResponseByte: func() { now(&this.firstByte) },
+	}
+}
+
+func (this *probeTrace) apply(ret *ProbeResult, start time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	between := func(from, to time.Time) Milliseconds {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return Milliseconds(to.Sub(from))
+	}
+
+	ret.Dns = between(this.dnsStart, this.dnsDone)
+	ret.Connect = between(this.connectStart, this.connectDone)
+	ret.Tls = between(this.tlsStart, this.tlsDone)
+	ret.FirstByte = between(start, this.firstByte)
+}
+
+// Probe runs a single check, the same way the daemon does, without
+// recording its result.
+func (this *Ping) Probe(ctx context.Context) ProbeResult {
+	ret := ProbeResult{Title: this.title, Url: this.Url()}
+	fail := func(err error) ProbeResult {
+		ret.err = err
+		ret.Error = config.Redact(err.Error())
+		return ret
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, this.timeout)
+	defer cancel()
+
+	trace := &probeTrace{}
+	reqCtx = httptrace.WithClientTrace(reqCtx, trace.ClientTrace())
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", this.url, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	before := time.Now()
+	res, err := this.client.Do(req)
+	after := time.Now()
+	ret.latency = after.UnixMilli() - before.UnixMilli()
+	ret.Total = Milliseconds(after.Sub(before))
+	trace.apply(&ret, before)
+	if err != nil {
+		return fail(err)
+	}
+	defer res.Body.Close()
+
+	ret.Status = res.Status
+	ret.StatusCode = res.StatusCode
+
+	isUp, err := this.check.IsUp(res)
+	if err == nil && !isUp {
+		err = fmt.Errorf("check failed (status: %s)", res.Status)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	ret.Health = true
+	return ret
+}
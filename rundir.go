@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RunDir is the daemon's directory that, unlike the PID directory, does not
+// change across restarts. It holds a "current" link to the PID directory of
+// the running daemon and a lock that keeps a second daemon out.
+type RunDir struct {
+	path   string
+	lock   *os.File
+	target string
+}
+
+var errLocked = errors.New("locked")
+
+// LockRunDir locks the directory, failing if another daemon holds it.
+func LockRunDir(path string) (*RunDir, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(
+		filepath.Join(path, "avail.lock"), os.O_CREATE|os.O_RDWR, 0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tryLock(lock)
+	if errors.Is(err, errLocked) {
+		lock.Close()
+		return nil, fmt.Errorf("another daemon is running in %s", path)
+	}
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return &RunDir{path: path, lock: lock}, nil
+}
+
+// Link points "current" to the given directory, replacing the link of a
+// previous daemon.
+func (this *RunDir) Link(target string) error {
+	link := this.Current()
+	tmp := link + ".tmp"
+
+	os.Remove(tmp)
+	err := os.Symlink(target, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, link)
+	if err != nil {
+		return err
+	}
+
+	this.target = target
+	return nil
+}
+
+// Current returns the path of the link to the running daemon's directory.
+func (this *RunDir) Current() string {
+	return filepath.Join(this.path, "current")
+}
+
+// Close removes the link and releases the lock.
+func (this *RunDir) Close() error {
+	if this.target != "" {
+		err := os.Remove(this.Current())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			this.lock.Close()
+			return err
+		}
+	}
+
+	return this.lock.Close()
+}
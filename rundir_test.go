@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunDir(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "1234")
+
+	rd, err := LockRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	_, err = LockRunDir(dir)
+	if err == nil {
+		t.Fatal("expected a second daemon to be locked out")
+		return
+	}
+
+	err = rd.Link(target)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	link, err := os.Readlink(rd.Current())
+	if err != nil || link != target {
+		t.Fatalf("unexpected link %s: %v", link, err)
+		return
+	}
+
+	err = rd.Close()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	_, err = os.Lstat(rd.Current())
+	if !os.IsNotExist(err) {
+		t.Fatal("expected the link to be removed")
+		return
+	}
+
+	rd, err = LockRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	rd.Close()
+}
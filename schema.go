@@ -0,0 +1,14 @@
+package main
+
+import (
+	_ "embed"
+
+	"github.com/thekhanj/avail/config"
+)
+
+//go:embed schema.json
+var schemaJson []byte
+
+func init() {
+	config.SetSchema(schemaJson)
+}
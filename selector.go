@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Selector selects sites by their tags and group, e.g. -l env=prod,team=api
+// for the sites tagged with both. A requirement is one of key=value,
+// key!=value, key (the tag is set) or !key (the tag is not set).
+type Selector struct {
+	requirements []requirement
+	group        string
+}
+
+type requirement struct {
+	key   string
+	value string
+	// one of "=", "!=", "exists" and "!exists"
+	op string
+}
+
+// ParseSelector parses the comma separated requirements of labels, and
+// requires the group unless empty.
+func ParseSelector(labels, group string) (*Selector, error) {
+	ret := &Selector{group: group}
+
+	for _, r := range strings.Split(labels, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		var req requirement
+		if key, value, ok := strings.Cut(r, "!="); ok {
+			req = requirement{key: key, value: value, op: "!="}
+		} else if key, value, ok := strings.Cut(r, "="); ok {
+			req = requirement{key: key, value: value, op: "="}
+		} else if key, ok := strings.CutPrefix(r, "!"); ok {
+			req = requirement{key: key, op: "!exists"}
+		} else {
+			req = requirement{key: r, op: "exists"}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if req.key == "" {
+			return nil, fmt.Errorf("invalid selector \"%s\"", r)
+		}
+		ret.requirements = append(ret.requirements, req)
+	}
+
+	return ret, nil
+}
+
+// Empty reports whether the selector selects every site.
+func (this *Selector) Empty() bool {
+	return len(this.requirements) == 0 && this.group == ""
+}
+
+func (this *Selector) Matches(entry SiteEntry) bool {
+	if this.group != "" && entry.Group != this.group {
+		return false
+	}
+
+	for _, r := range this.requirements {
+		value, ok := entry.Tags[r.key]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (this *Selector) Filter(statuses SiteStatusList) SiteStatusList {
+	ret := make(SiteStatusList, 0, len(statuses))
+	for _, s := range statuses {
+		if this.Matches(s.SiteEntry) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+var ErrNoSiteSelected = errors.New("no site matches the selector")
+
+type SelectorFlags struct {
+	labels string
+	group  string
+}
+
+func (this *SelectorFlags) SetFlags(f *flag.FlagSet) {
+	f.StringVar(
+		&this.labels, "l", "",
+		"select sites by tags, e.g. env=prod,team!=payments",
+	)
+	f.StringVar(&this.group, "group", "", "select the sites of a group")
+}
+
+func (this *SelectorFlags) Selector() (*Selector, error) {
+	return ParseSelector(this.labels, this.group)
+}
+
+// Select narrows the given titles, or all sites if titles is empty, down to
+// the selected sites. Without a selector, titles are returned as is.
+func (this *SelectorFlags) Select(client Client, titles []string) ([]string, error) {
+	selector, err := this.Selector()
+	if err != nil {
+		return nil, err
+	}
+	if selector.Empty() {
+		return titles, nil
+	}
+
+	statuses, err := client.SitesStatus(titles)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0)
+	for _, s := range selector.Filter(statuses) {
+		ret = append(ret, s.Title)
+	}
+	if len(ret) == 0 {
+		return nil, ErrNoSiteSelected
+	}
+	return ret, nil
+}
+
+// formatTags formats tags the way they are selected, e.g. env=prod,team=api.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		pairs = append(pairs, k+"="+tags[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseTags parses the output of formatTags.
+func parseTags(s string) map[string]string {
+	ret := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if ok {
+			ret[k] = v
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
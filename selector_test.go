@@ -0,0 +1,116 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	api := SiteEntry{
+		Title: "api", Group: "edge",
+		Tags: map[string]string{"env": "prod", "team": "payments"},
+	}
+	web := SiteEntry{
+		Title: "web",
+		Tags:  map[string]string{"env": "staging"},
+	}
+	db := SiteEntry{Title: "db", Group: "core"}
+
+	tests := []struct {
+		labels string
+		group  string
+		want   []string
+	}{
+		{"", "", []string{"api", "web", "db"}},
+		{"env=prod", "", []string{"api"}},
+		{"env=prod,team=payments", "", []string{"api"}},
+		{"env=prod,team=search", "", []string{}},
+		{"env!=prod", "", []string{"web", "db"}},
+		{"env", "", []string{"api", "web"}},
+		{"!env", "", []string{"db"}},
+		{" env = staging ", "", []string{"web"}},
+		{"", "edge", []string{"api"}},
+		{"env=staging", "edge", []string{}},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.labels, test.group)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		got := make([]string, 0)
+		for _, entry := range []SiteEntry{api, web, db} {
+			if selector.Matches(entry) {
+				got = append(got, entry.Title)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%q %q: expected %v, got %v", test.labels, test.group, test.want, got)
+			return
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("%q %q: expected %v, got %v", test.labels, test.group, test.want, got)
+				return
+			}
+		}
+	}
+
+	for _, labels := range []string{"=prod", "!=prod", "!"} {
+		_, err := ParseSelector(labels, "")
+		if err == nil {
+			t.Fatalf("%q: expected an error", labels)
+			return
+		}
+	}
+}
+
+func TestGroupStatuses(t *testing.T) {
+	statuses := SiteStatusList{
+		{SiteEntry: SiteEntry{Title: "a", Group: "edge"}, State: STATE_UP},
+		{SiteEntry: SiteEntry{Title: "b"}, State: STATE_UP},
+		{SiteEntry: SiteEntry{Title: "c", Group: "core"}, State: STATE_UP},
+		{SiteEntry: SiteEntry{Title: "d", Group: "edge"}, State: STATE_DOWN},
+		{SiteEntry: SiteEntry{Title: "e", Group: "edge"}, State: STATE_PAUSED},
+	}
+
+	groups := GroupStatuses(statuses)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+		return
+	}
+
+	edge := groups[0]
+	if edge.Group != "edge" || edge.Up != 1 || edge.Total != 2 ||
+		len(edge.Sites) != 3 || edge.State != STATE_DEGRADED {
+		t.Fatalf("unexpected group: %+v", edge)
+		return
+	}
+	if groups[1].Group != "core" || groups[1].State != STATE_UP {
+		t.Fatalf("unexpected group: %+v", groups[1])
+		return
+	}
+	if groups[2].Group != UNGROUPED || groups[2].Sites[0].Title != "b" {
+		t.Fatalf("unexpected group: %+v", groups[2])
+		return
+	}
+}
+
+func TestTags(t *testing.T) {
+	tags := map[string]string{"team": "payments", "env": "prod", "empty": ""}
+
+	s := formatTags(tags)
+	if s != "empty=,env=prod,team=payments" {
+		t.Fatalf("unexpected tags: %s", s)
+		return
+	}
+	if !maps.Equal(parseTags(s), tags) {
+		t.Fatalf("expected %v, got %v", tags, parseTags(s))
+		return
+	}
+	if parseTags("") != nil {
+		t.Fatal("expected no tags")
+		return
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+//go:embed web
+var webFS embed.FS
+
+// SiteSource provides the sites served by Server.
+type SiteSource interface {
+	Pings() []*Ping
+}
+
+type ServerOption = func(server *Server)
+
+func NewServer(
+	cfg *config.StatusPage, sites SiteSource, opts ...ServerOption,
+) (*Server, error) {
+	tmpl, err := template.New("status.html").Funcs(template.FuncMap{
+		"percent": formatPercent,
+		"dayTitle": func(d DayUptime) string {
+			ratio, ok := d.Ratio()
+			if !ok {
+				return d.Day.Format(time.DateOnly) + ": no data"
+			}
+			return d.Day.Format(time.DateOnly) + ": " + formatPercent(ratio, true)
+		},
+		"dayClass": dayClass,
+		"time": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04 MST")
+		},
+		"duration": func(from, to time.Time) string {
+			if to.IsZero() {
+				to = time.Now()
+			}
+			return formatDuration(to.Sub(from))
+		},
+	}).ParseFS(webFS, "web/status.html")
+	if err != nil {
+		return nil, err
+	}
+
+	base := &Server{
+		cfg:   cfg,
+		sites: sites,
+		tmpl:  tmpl,
+		log:   slog.Default().With("component", "server"),
+	}
+
+	for _, o := range opts {
+		o(base)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", base.handlePage)
+	mux.HandleFunc("GET /api/status", base.handleApi)
+	mux.HandleFunc("GET /badge/{file}", base.handleStateBadge)
+	mux.HandleFunc("GET /badge/{title}/uptime.svg", base.handleUptimeBadge)
+	base.mux = mux
+
+	return base, nil
+}
+
+func ServerWithLog(log *slog.Logger) ServerOption {
+	return func(server *Server) {
+		server.log = log
+	}
+}
+
+// Server serves the public status page of the daemon.
+type Server struct {
+	cfg   *config.StatusPage
+	sites SiteSource
+	tmpl  *template.Template
+	log   *slog.Logger
+	mux   *http.ServeMux
+}
+
+func (this *Server) Run(ctx context.Context) error {
+	l, err := net.Listen("tcp", this.cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	return this.Serve(ctx, l)
+}
+
+func (this *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           this.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	this.log.Info("serving status page", "addr", l.Addr().String())
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (this *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mux.ServeHTTP(w, r)
+}
+
+func (this *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := this.tmpl.Execute(w, this.Page())
+	if err != nil {
+		this.log.Error("rendering status page failed", "error", err)
+	}
+}
+
+func (this *Server) handleApi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(this.Page())
+	if err != nil {
+		this.log.Error("writing response failed", "error", err)
+	}
+}
+
+func (this *Server) handleStateBadge(w http.ResponseWriter, r *http.Request) {
+	title, ok := strings.CutSuffix(r.PathValue("file"), ".svg")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ping := this.ping(title)
+	if ping == nil {
+		this.writeBadge(w, title, "unknown", BADGE_NEUTRAL)
+		return
+	}
+
+	state := ping.Status().State
+	this.writeBadge(w, title, strings.ToLower(state.Label()), stateBadgeColor(state))
+}
+
+func (this *Server) handleUptimeBadge(w http.ResponseWriter, r *http.Request) {
+	window := BADGE_DEFAULT_WINDOW
+	if q := r.URL.Query().Get("window"); q != "" {
+		var err error
+		window, err = ParseWindow(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	label := "uptime " + formatWindow(window)
+
+	ping := this.ping(r.PathValue("title"))
+	if ping == nil {
+		this.writeBadge(w, label, "unknown", BADGE_NEUTRAL)
+		return
+	}
+
+	uptime, ok := ping.Uptime(window)
+	if !ok {
+		this.writeBadge(w, label, "no data", BADGE_NEUTRAL)
+		return
+	}
+
+	this.writeBadge(w, label, formatPercent(uptime, true), uptimeBadgeColor(uptime))
+}
+
+func (this *Server) writeBadge(w http.ResponseWriter, label, message, color string) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// badges are usually embedded through caching proxies
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+
+	_, err := w.Write(RenderBadge(label, message, color))
+	if err != nil {
+		this.log.Error("writing response failed", "error", err)
+	}
+}
+
+func (this *Server) ping(title string) *Ping {
+	for _, p := range this.sites.Pings() {
+		if p.Title() == title {
+			return p
+		}
+	}
+
+	return nil
+}
+
+type Page struct {
+	Title     string         `json:"title"`
+	Logo      string         `json:"logo,omitempty"`
+	State     State          `json:"state"`
+	Updated   time.Time      `json:"updated"`
+	Groups    []PageGroup    `json:"groups"`
+	Incidents []PageIncident `json:"incidents"`
+}
+
+type PageGroup struct {
+	Title string     `json:"title"`
+	State State      `json:"state"`
+	Sites []PageSite `json:"sites"`
+}
+
+type PageSite struct {
+	Title   string      `json:"title"`
+	Url     string      `json:"url,omitempty"`
+	State   State       `json:"state"`
+	Latency int64       `json:"latency"`
+	Since   time.Time   `json:"since,omitzero"`
+	Error   string      `json:"error,omitempty"`
+	Uptime  *float64    `json:"uptime"`
+	Days    []DayUptime `json:"days"`
+}
+
+type PageIncident struct {
+	Site string `json:"site"`
+	Incident
+}
+
+// Page builds the current status page from the daemon's live state.
+func (this *Server) Page() Page {
+	ret := Page{
+		Title:     this.cfg.Title,
+		Updated:   time.Now(),
+		Groups:    make([]PageGroup, 0),
+		Incidents: make([]PageIncident, 0),
+	}
+	if this.cfg.Logo != nil {
+		ret.Logo = *this.cfg.Logo
+	}
+
+	sites := make(map[string]PageSite)
+	order := make([]string, 0)
+	for _, ping := range this.sites.Pings() {
+		site := this.site(ping)
+		sites[site.Title] = site
+		order = append(order, site.Title)
+
+		for _, i := range ping.Incidents() {
+			if this.cfg.HideUrls {
+				i.Error = this.hideUrl(i.Error, ping.Url())
+			}
+			ret.Incidents = append(ret.Incidents, PageIncident{site.Title, i})
+		}
+	}
+
+	slices.SortFunc(ret.Incidents, func(a, b PageIncident) int {
+		return b.Start.Compare(a.Start)
+	})
+	ret.Incidents = ret.Incidents[:min(len(ret.Incidents), INCIDENTS_SIZE)]
+
+	grouped := make(map[string]bool)
+	for _, g := range this.cfg.Groups {
+		group := PageGroup{Title: g.Title, Sites: make([]PageSite, 0)}
+		for _, title := range g.Sites {
+			site, ok := sites[title]
+			if !ok {
+				continue
+			}
+			group.Sites = append(group.Sites, site)
+			grouped[title] = true
+		}
+		ret.Groups = append(ret.Groups, group)
+	}
+
+	rest := PageGroup{Sites: make([]PageSite, 0)}
+	if len(this.cfg.Groups) != 0 {
+		rest.Title = "Other"
+	}
+	for _, title := range order {
+		if !grouped[title] {
+			rest.Sites = append(rest.Sites, sites[title])
+		}
+	}
+	if len(rest.Sites) != 0 {
+		ret.Groups = append(ret.Groups, rest)
+	}
+
+	all := make(SiteStatusList, 0)
+	for i, g := range ret.Groups {
+		list := make(SiteStatusList, len(g.Sites))
+		for j, s := range g.Sites {
+			list[j] = &SiteStatus{State: s.State}
+		}
+		ret.Groups[i].State = list.State()
+		all = append(all, list...)
+	}
+	ret.State = all.State()
+
+	return ret
+}
+
+func (this *Server) site(ping *Ping) PageSite {
+	status := ping.Status()
+
+	ret := PageSite{
+		Title:   status.Title,
+		Url:     status.Url,
+		State:   status.State,
+		Latency: status.Latency,
+		Since:   status.Since,
+		Error:   status.Error,
+		Days:    ping.Days(UPTIME_DAYS),
+	}
+
+	uptime, ok := ping.Uptime(UPTIME_DAYS * 24 * time.Hour)
+	if ok {
+		ret.Uptime = &uptime
+	}
+
+	if this.cfg.HideUrls {
+		ret.Url = ""
+		ret.Error = this.hideUrl(ret.Error, status.Url)
+	}
+
+	return ret
+}
+
+// hideUrl removes the URL of a site, and its host, from s (e.g. an error
+// message).
+func (this *Server) hideUrl(s, addr string) string {
+	s = strings.ReplaceAll(s, addr, "<hidden>")
+
+	u, err := url.Parse(addr)
+	if err == nil && u.Host != "" {
+		s = strings.ReplaceAll(s, u.Host, "<hidden>")
+		s = strings.ReplaceAll(s, u.Hostname(), "<hidden>")
+	}
+
+	return s
+}
+
+// formatPercent formats a ratio as a percentage. With exact set, 100% is
+// only shown if there were no failures at all.
+func formatPercent(ratio float64, exact bool) string {
+	ret := fmt.Sprintf("%.2f%%", ratio*100)
+	if exact && ratio < 1 && ret == "100.00%" {
+		return "99.99%"
+	}
+	return ret
+}
+
+func dayClass(d DayUptime) string {
+	ratio, ok := d.Ratio()
+	switch {
+	case !ok:
+		return "none"
+	case ratio >= 0.999:
+		return "up"
+	case ratio >= 0.95:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
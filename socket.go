@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thekhanj/avail/common"
+)
+
+// The control socket speaks JSON over HTTP:
+//
+//	GET  /sites[?title=...]        status of all (or the given) sites
+//	GET  /sites/{title}            status of a site
+//	GET  /sites/{title}/history    recent samples of a site
+//	POST /sites/{title}/{request}  check, pause or resume a site
+//	POST /sites/{title}/check?wait  check a site and return its new status
+//	POST /sites/{title}/pause?for=  pause a site for a duration
+//	POST /reload                   reload the config
+//	POST /shutdown                 stop the daemon
+//
+// Errors are returned as {"error": "..."} with a non-2xx status code.
+
+type ControlServerOption = func(server *ControlServer)
+
+// ControlServer serves the control socket of a daemon.
+type ControlServer struct {
+	daemon   *Daemon
+	shutdown context.CancelFunc
+	log      *slog.Logger
+	mux      *http.ServeMux
+
+	// the context the daemon runs in, sites started by reloads inherit it
+	ctx context.Context
+}
+
+func NewControlServer(
+	daemon *Daemon, shutdown context.CancelFunc, opts ...ControlServerOption,
+) *ControlServer {
+	base := &ControlServer{
+		daemon:   daemon,
+		shutdown: shutdown,
+		log:      slog.Default().With("component", "control"),
+	}
+
+	for _, o := range opts {
+		o(base)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sites", base.handleSites)
+	mux.HandleFunc("GET /sites/{title}", base.handleSite)
+	mux.HandleFunc("GET /sites/{title}/history", base.handleHistory)
+	mux.HandleFunc("POST /sites/{title}/{request}", base.handleRequest)
+	mux.HandleFunc("POST /reload", base.handleReload)
+	mux.HandleFunc("POST /shutdown", base.handleShutdown)
+	base.mux = mux
+
+	return base
+}
+
+func ControlServerWithLog(log *slog.Logger) ControlServerOption {
+	return func(server *ControlServer) {
+		server.log = log
+	}
+}
+
+// Run listens on the given unix socket until ctx is done.
+func (this *ControlServer) Run(ctx context.Context, path string) error {
+	l, err := ListenControl(path)
+	if err != nil {
+		return err
+	}
+
+	return this.Serve(ctx, l)
+}
+
+// ListenControl listens on the given unix socket, replacing a stale one
+// left by a crashed daemon. The socket allows controlling the daemon, so
+// only the current user can connect to it, other users fall back to the
+// (read-only for them) files.
+func ListenControl(path string) (net.Listener, error) {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return listenPrivate(path)
+}
+
+func (this *ControlServer) Serve(ctx context.Context, l net.Listener) error {
+	this.ctx = ctx
+
+	srv := &http.Server{
+		Handler:           this.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (this *ControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mux.ServeHTTP(w, r)
+}
+
+func (this *ControlServer) handleSites(w http.ResponseWriter, r *http.Request) {
+	titles := r.URL.Query()["title"]
+
+	ret := make([]SiteStatus, 0)
+	if len(titles) == 0 {
+		for _, ping := range this.daemon.Pings() {
+			ret = append(ret, ping.Status())
+		}
+	} else {
+		for _, title := range titles {
+			ping := this.ping(title)
+			if ping == nil {
+				this.writeError(w, http.StatusNotFound, fmt.Errorf("site not found: %s", title))
+				return
+			}
+			ret = append(ret, ping.Status())
+		}
+	}
+
+	this.writeJson(w, ret)
+}
+
+func (this *ControlServer) handleSite(w http.ResponseWriter, r *http.Request) {
+	ping := this.requirePing(w, r)
+	if ping == nil {
+		return
+	}
+
+	this.writeJson(w, ping.Status())
+}
+
+func (this *ControlServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	ping := this.requirePing(w, r)
+	if ping == nil {
+		return
+	}
+
+	this.writeJson(w, ping.History())
+}
+
+func (this *ControlServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	ping := this.requirePing(w, r)
+	if ping == nil {
+		return
+	}
+
+	request := r.PathValue("request")
+	if request == REQUEST_CHECK && r.URL.Query().Has("wait") {
+		status, err := ping.CheckNow(r.Context())
+		if err != nil {
+			this.writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		this.writeJson(w, status)
+		return
+	}
+
+	if d := r.URL.Query().Get("for"); d != "" {
+		request += " " + d
+	}
+
+	err := ping.Request(request)
+	if err != nil {
+		this.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (this *ControlServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	err := this.daemon.Reload(this.ctx)
+	if err != nil {
+		this.log.Error("reload failed", "error", err)
+		this.writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (this *ControlServer) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	this.log.Info("shutdown requested")
+	w.WriteHeader(http.StatusNoContent)
+
+	this.shutdown()
+}
+
+func (this *ControlServer) requirePing(w http.ResponseWriter, r *http.Request) *Ping {
+	title := r.PathValue("title")
+
+	ping := this.ping(title)
+	if ping == nil {
+		this.writeError(w, http.StatusNotFound, fmt.Errorf("site not found: %s", title))
+	}
+
+	return ping
+}
+
+func (this *ControlServer) ping(title string) *Ping {
+	for _, p := range this.daemon.Pings() {
+		if p.Title() == title {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (this *ControlServer) writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		this.log.Error("writing response failed", "error", err)
+	}
+}
+
+func (this *ControlServer) writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(controlError{err.Error()})
+}
+
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// ControlClient is a Client using the control socket of a daemon.
+type ControlClient struct {
+	client *http.Client
+}
+
+var _ Client = (*ControlClient)(nil)
+
+// DialControl connects to the control socket of the daemon with the given
+// PID.
+func DialControl(pid int) (*ControlClient, error) {
+	return DialControlPath(common.GetControlSocket(pid))
+}
+
+func DialControlPath(path string) (*ControlClient, error) {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+
+	conn, err := dial(context.Background(), "", "")
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	return &ControlClient{
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+			// reloads wait for in-flight checks of changed sites
+			Timeout: time.Minute,
+		},
+	}, nil
+}
+
+func (this *ControlClient) Titles() ([]string, error) {
+	statuses, err := this.SitesStatus(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, len(statuses))
+	for i, s := range statuses {
+		ret[i] = s.Title
+	}
+
+	return ret, nil
+}
+
+func (this *ControlClient) SiteEntry(title string) (SiteEntry, error) {
+	var ret SiteStatus
+	err := this.do("GET", "/sites/"+url.PathEscape(title), &ret)
+
+	return ret.SiteEntry, err
+}
+
+// SitesStatus returns the status of the given sites, or all sites if titles
+// is empty.
+func (this *ControlClient) SitesStatus(titles []string) (SiteStatusList, error) {
+	path := "/sites"
+	if len(titles) != 0 {
+		path += "?" + url.Values{"title": titles}.Encode()
+	}
+
+	var ret SiteStatusList
+	err := this.do("GET", path, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	titleLength := ret.MaxTitleLength()
+	ret.Apply(SiteStatusWithTitleLength(titleLength))
+
+	return ret, nil
+}
+
+func (this *ControlClient) History(title string) ([]Sample, error) {
+	var ret []Sample
+	err := this.do("GET", "/sites/"+url.PathEscape(title)+"/history", &ret)
+
+	return ret, err
+}
+
+func (this *ControlClient) Request(title, request string) error {
+	name, arg, _ := strings.Cut(request, " ")
+
+	path := "/sites/" + url.PathEscape(title) + "/" + url.PathEscape(name)
+	if arg != "" {
+		path += "?" + url.Values{"for": {arg}}.Encode()
+	}
+
+	return this.do("POST", path, nil)
+}
+
+func (this *ControlClient) CheckNow(ctx context.Context, title string) (SiteStatus, error) {
+	var ret SiteStatus
+	err := this.doContext(ctx, "POST", "/sites/"+url.PathEscape(title)+"/check?wait", &ret)
+
+	return ret, err
+}
+
+func (this *ControlClient) Reload() error {
+	return this.do("POST", "/reload", nil)
+}
+
+func (this *ControlClient) Shutdown() error {
+	return this.do("POST", "/shutdown", nil)
+}
+
+func (this *ControlClient) do(method, path string, out any) error {
+	return this.doContext(context.Background(), method, path, out)
+}
+
+func (this *ControlClient) doContext(ctx context.Context, method, path string, out any) error {
+	// the host is ignored, requests always go to the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://avail"+path, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		var e controlError
+		err = json.Unmarshal(body, &e)
+		if err != nil || e.Error == "" {
+			return fmt.Errorf("control socket: %s", res.Status)
+		}
+		return errors.New(e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "net"
+
+// listenPrivate listens on a unix socket, whose access is left to the
+// permissions of its directory on other platforms.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
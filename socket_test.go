@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestControlSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	d := NewDaemon(&config.Config{
+		Sites: []config.Ping{
+			{Title: "a", Url: srv.URL, Interval: "1s", Timeout: "1s"},
+			{Title: "b", Url: srv.URL, Interval: "1s", Timeout: "1s"},
+		},
+	}, DaemonWithPidDir(t.TempDir()))
+	err := d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	done := make(chan error)
+	go func() {
+		done <- NewControlServer(d, cancel).Run(ctx, path)
+	}()
+
+	var client *ControlClient
+	for client == nil {
+		client, err = DialControlPath(path)
+		select {
+		case err := <-done:
+			t.Fatal(err)
+			return
+		default:
+		}
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if runtime.GOOS != "windows" && stat.Mode().Perm() != 0600 {
+		t.Fatalf("expected a private socket, got %s", stat.Mode())
+		return
+	}
+
+	titles, err := client.Titles()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(titles) != 2 || titles[0] != "a" || titles[1] != "b" {
+		t.Fatalf("unexpected titles: %v", titles)
+		return
+	}
+
+	err = client.Request("b", REQUEST_PAUSE)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	statuses, err := client.SitesStatus([]string{"b"})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(statuses) != 1 || statuses[0].State != STATE_PAUSED {
+		t.Fatalf("expected b to be paused, got %v", statuses)
+		return
+	}
+
+	err = client.Request("b", "bogus")
+	if err == nil {
+		t.Fatal("expected invalid request to fail")
+		return
+	}
+	_, err = client.SiteEntry("c")
+	if err == nil || err.Error() != "site not found: c" {
+		t.Fatalf("expected site not found, got %v", err)
+		return
+	}
+
+	err = client.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	d.wg.Wait()
+}
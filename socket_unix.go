@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate listens on a unix socket that only the current user can
+// connect to from the start. The umask is process wide, so nothing else
+// must create files meanwhile.
+func listenPrivate(path string) (net.Listener, error) {
+	umask := syscall.Umask(0177)
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", path)
+}
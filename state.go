@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// StateFile is what the daemon persists across restarts, so that e.g. when
+// a site went down is not forgotten.
+type StateFile struct {
+	Saved time.Time            `json:"saved"`
+	Sites map[string]PingState `json:"sites"`
+}
+
+// PingState is the state of a site, see Ping.State.
+type PingState struct {
+	Url         string      `json:"url"`
+	Checked     bool        `json:"checked"`
+	Health      bool        `json:"health"`
+	Since       time.Time   `json:"since,omitzero"`
+	Latency     int64       `json:"latency"`
+	Error       string      `json:"error,omitempty"`
+	Paused      bool        `json:"paused,omitempty"`
+	PausedUntil time.Time   `json:"pausedUntil,omitzero"`
+	History     []Sample    `json:"history"`
+	Days        []DayUptime `json:"days"`
+	Incidents   []Incident  `json:"incidents"`
+}
+
+// ReadStateFile reads the state saved by WriteStateFile. A missing file
+// results in an empty state.
+func ReadStateFile(path string) (*StateFile, error) {
+	ret := &StateFile{Sites: make(map[string]PingState)}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, ret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if ret.Sites == nil {
+		ret.Sites = make(map[string]PingState)
+	}
+
+	return ret, nil
+}
+
+// WriteStateFile replaces the state file atomically.
+func WriteStateFile(path string, state *StateFile) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// State returns the state of the site to be restored by a future daemon.
+func (this *Ping) State() PingState {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return PingState{
+		Url:         this.Url(),
+		Checked:     !this.firstTime,
+		Health:      this.wasHealthy,
+		Since:       this.since,
+		Latency:     this.latency,
+		Error:       this.lastErr,
+		Paused:      this.paused.Load(),
+		PausedUntil: this.pausedUntil,
+		History:     this.stats.History(),
+		Days:        slices.Clone(this.stats.days),
+		Incidents:   slices.Clone(this.stats.incidents),
+	}
+}
+
+// Restore continues from a state saved by a previous daemon. It must be
+// called before Run. A state of another URL is ignored, as it describes a
+// different site. URLs are compared with their secrets redacted, which are
+// not saved.
+func (this *Ping) Restore(state PingState) {
+	if state.Url != this.Url() {
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.firstTime = !state.Checked
+	this.wasHealthy = state.Health
+	this.since = state.Since
+	this.latency = state.Latency
+	this.lastErr = state.Error
+	this.stats = &Stats{
+		history:   lastN(state.History, HISTORY_SIZE),
+		days:      lastN(state.Days, UPTIME_DAYS),
+		incidents: lastN(state.Incidents, INCIDENTS_SIZE),
+	}
+
+	if state.Paused &&
+		(state.PausedUntil.IsZero() || state.PausedUntil.After(time.Now())) {
+		this.pauseUntil(state.PausedUntil)
+	}
+}
+
+// writeRestored writes the files of a restored state.
+func (this *Ping) writeRestored() {
+	this.mu.Lock()
+	checked := !this.firstTime
+	health := this.wasHealthy
+	since := this.since
+	latency := this.latency
+	lastErr := this.lastErr
+	history := this.stats.History()
+	paused := ""
+	if this.paused.Load() {
+		paused = this.pausedContent()
+	}
+	this.mu.Unlock()
+
+	if paused != "" {
+		this.writeFile("paused", paused)
+	}
+	if !checked {
+		return
+	}
+
+	content := "0\n"
+	if health {
+		content = "1\n"
+	}
+	if lastErr != "" {
+		lastErr += "\n"
+	}
+
+	this.writeFile("health", content)
+	this.writeFile("since", since.Format(time.RFC3339)+"\n")
+	this.writeFile("latency", fmt.Sprintf("%d\n", latency))
+	this.writeFile("error", lastErr)
+	this.writeHistory(history)
+}
+
+func lastN[T any](s []T, n int) []T {
+	return append([]T(nil), s[max(0, len(s)-n):]...)
+}
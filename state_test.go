@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestStateRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	old, err := NewPing(
+		"local", "http://127.0.0.1",
+		PingWithPath(filepath.Join(dir, "old")),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	err = old.createDir()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	old.update(10, false, errors.New("refused"))
+	old.PauseFor(time.Hour)
+
+	path := filepath.Join(dir, "state.json")
+	err = WriteStateFile(path, &StateFile{
+		Saved: time.Now(),
+		Sites: map[string]PingState{"local": old.State()},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	state, err := ReadStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	restored, err := NewPing(
+		"local", "http://127.0.0.1",
+		PingWithPath(filepath.Join(dir, "new")),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	restored.Restore(state.Sites["local"])
+
+	before, after := old.Status(), restored.Status()
+	if after.State != STATE_PAUSED || after.Error != "refused" ||
+		!after.Since.Equal(before.Since) {
+		t.Fatalf("unexpected restored status: %v", after)
+		return
+	}
+	if len(restored.History()) != 1 || len(restored.Incidents()) != 1 {
+		t.Fatal("expected the history to be restored")
+		return
+	}
+
+	moved, err := NewPing("local", "http://127.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	moved.Restore(state.Sites["local"])
+	if moved.Status().State != STATE_UNKNOWN {
+		t.Fatal("state of another URL must be ignored")
+		return
+	}
+
+	missing, err := ReadStateFile(filepath.Join(dir, "missing.json"))
+	if err != nil || len(missing.Sites) != 0 {
+		t.Fatalf("expected an empty state, got %v, %v", missing, err)
+		return
+	}
+}
+
+func TestDaemonRestoreAdded(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	site := func(title, interval string) config.Ping {
+		return config.Ping{
+			Title:    title,
+			Url:      "http://127.0.0.1:1",
+			Interval: config.Duration(interval),
+			Timeout:  "1s",
+		}
+	}
+	paused := PingState{Url: "http://127.0.0.1:1", Paused: true}
+
+	d := NewDaemon(
+		&config.Config{Sites: []config.Ping{site("a", "1h")}},
+		DaemonWithPidDir(t.TempDir()),
+	)
+	d.restored = map[string]PingState{"a": paused, "b": paused}
+	err := d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	// b is only added by a reload, and a is restarted
+	err = d.apply(ctx, &config.Config{
+		Sites: []config.Ping{site("a", "2h"), site("b", "1h")},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	pings := d.Pings()
+	if pings[0].Status().State == STATE_PAUSED {
+		t.Fatal("a state must only be restored once")
+		return
+	}
+	if pings[1].Status().State != STATE_PAUSED {
+		t.Fatal("expected the state of a site added later to be restored")
+		return
+	}
+
+	cancel()
+	d.wg.Wait()
+}
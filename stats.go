@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	UPTIME_DAYS    = 90
+	INCIDENTS_SIZE = 20
+)
+
+// DayUptime counts the checks of a single (local) day.
+type DayUptime struct {
+	Day   time.Time `json:"day"`
+	Up    int       `json:"up"`
+	Total int       `json:"total"`
+}
+
+// Ratio returns the fraction of successful checks, or false if there were
+// no checks on that day.
+func (this DayUptime) Ratio() (float64, bool) {
+	if this.Total == 0 {
+		return 0, false
+	}
+
+	return float64(this.Up) / float64(this.Total), true
+}
+
+// Incident is a period of consecutive failed checks. End is zero while the
+// incident is ongoing.
+type Incident struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitzero"`
+	Error string    `json:"error"`
+}
+
+func (this Incident) Ongoing() bool {
+	return this.End.IsZero()
+}
+
+// Stats keeps the recent history of a site. It is not safe for concurrent
+// use.
+type Stats struct {
+	history   []Sample
+	days      []DayUptime
+	incidents []Incident
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		history:   make([]Sample, 0, HISTORY_SIZE),
+		days:      make([]DayUptime, 0, UPTIME_DAYS),
+		incidents: make([]Incident, 0, INCIDENTS_SIZE),
+	}
+}
+
+func (this *Stats) Record(sample Sample, err string) {
+	this.history = pushBounded(this.history, sample, HISTORY_SIZE)
+
+	day := startOfDay(sample.Time)
+	if len(this.days) == 0 || !this.days[len(this.days)-1].Day.Equal(day) {
+		this.days = pushBounded(this.days, DayUptime{Day: day}, UPTIME_DAYS)
+	}
+	today := &this.days[len(this.days)-1]
+	today.Total++
+	if sample.Health {
+		today.Up++
+	}
+
+	var last *Incident
+	if len(this.incidents) != 0 {
+		last = &this.incidents[len(this.incidents)-1]
+	}
+	ongoing := last != nil && last.Ongoing()
+
+	switch {
+	case !sample.Health && !ongoing:
+		this.incidents = pushBounded(
+			this.incidents,
+			Incident{Start: sample.Time, Error: err},
+			INCIDENTS_SIZE,
+		)
+	case sample.Health && ongoing:
+		last.End = sample.Time
+	}
+}
+
+// History returns the most recent samples, oldest first.
+func (this *Stats) History() []Sample {
+	return slices.Clone(this.history)
+}
+
+// Days returns the uptime of each of the last n days up to now, oldest
+// first. Days without any checks have a zero Total.
+func (this *Stats) Days(now time.Time, n int) []DayUptime {
+	ret := make([]DayUptime, n)
+
+	today := startOfDay(now)
+	for i := range ret {
+		ret[i].Day = today.AddDate(0, 0, i-n+1)
+	}
+
+	for _, d := range this.days {
+		for i := range ret {
+			if ret[i].Day.Equal(d.Day) {
+				ret[i] = d
+			}
+		}
+	}
+
+	return ret
+}
+
+// Uptime returns the fraction of successful checks during the window
+// ending now, rounded up to whole days, or false if there were no checks.
+func (this *Stats) Uptime(now time.Time, window time.Duration) (float64, bool) {
+	days := max(1, int(math.Ceil(window.Hours()/24)))
+	from := startOfDay(now).AddDate(0, 0, 1-days)
+
+	total := DayUptime{}
+	for _, d := range this.days {
+		if d.Day.Before(from) {
+			continue
+		}
+		total.Up += d.Up
+		total.Total += d.Total
+	}
+
+	return total.Ratio()
+}
+
+// Incidents returns the recent incidents, newest first.
+func (this *Stats) Incidents() []Incident {
+	ret := slices.Clone(this.incidents)
+	slices.Reverse(ret)
+	return ret
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func pushBounded[T any](s []T, v T, size int) []T {
+	if len(s) == size {
+		copy(s, s[1:])
+		s = s[:size-1]
+	}
+	return append(s, v)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsUptime(t *testing.T) {
+	s := NewStats()
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	s.Record(Sample{Time: now.AddDate(0, 0, -2), Health: false}, "down")
+	s.Record(Sample{Time: now.AddDate(0, 0, -1), Health: true}, "")
+	s.Record(Sample{Time: now, Health: true}, "")
+	s.Record(Sample{Time: now, Health: false}, "down")
+
+	uptime, ok := s.Uptime(now, 24*time.Hour)
+	if !ok || uptime != 0.5 {
+		t.Fatalf("expected 50%% uptime today, got %v (%v)", uptime, ok)
+		return
+	}
+
+	uptime, ok = s.Uptime(now, 3*24*time.Hour)
+	if !ok || uptime != 0.5 {
+		t.Fatalf("expected 50%% uptime in 3 days, got %v (%v)", uptime, ok)
+		return
+	}
+
+	days := s.Days(now, 5)
+	if len(days) != 5 || days[0].Total != 0 || days[2].Total != 1 ||
+		days[4].Total != 2 || !days[4].Day.Equal(startOfDay(now)) {
+		t.Fatalf("unexpected days: %+v", days)
+		return
+	}
+}
+
+func TestStatsIncidents(t *testing.T) {
+	s := NewStats()
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	s.Record(Sample{Time: now, Health: false}, "timeout")
+	s.Record(Sample{Time: now.Add(time.Minute), Health: false}, "refused")
+	s.Record(Sample{Time: now.Add(2 * time.Minute), Health: true}, "")
+	s.Record(Sample{Time: now.Add(3 * time.Minute), Health: false}, "503")
+
+	incidents := s.Incidents()
+	if len(incidents) != 2 {
+		t.Fatalf("expected 2 incidents, got %d", len(incidents))
+		return
+	}
+
+	if !incidents[0].Ongoing() || incidents[0].Error != "503" {
+		t.Fatalf("unexpected latest incident: %+v", incidents[0])
+		return
+	}
+
+	if incidents[1].Ongoing() || incidents[1].Error != "timeout" ||
+		incidents[1].End.Sub(incidents[1].Start) != 2*time.Minute {
+		t.Fatalf("unexpected first incident: %+v", incidents[1])
+		return
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// first file descriptor passed by socket activation, see sd_listen_fds(3)
+const LISTEN_FDS_START = 3
+
+// STATUS_INTERVAL is how often the daemon updates its status in systemd if
+// no watchdog is configured.
+const STATUS_INTERVAL = 10 * time.Second
+
+// Notifier speaks the systemd notify protocol, see sd_notify(3).
+type Notifier struct {
+	conn     *net.UnixConn
+	watchdog time.Duration
+}
+
+// NewNotifierFromEnv returns a notifier for the socket in $NOTIFY_SOCKET,
+// or nil if the daemon was not started with Type=notify. The variables are
+// unset, so checks run by the daemon don't inherit them.
+func NewNotifierFromEnv() (*Notifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	usec := os.Getenv("WATCHDOG_USEC")
+	watchdogPid := os.Getenv("WATCHDOG_PID")
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+
+	if path == "" {
+		return nil, nil
+	}
+
+	ret := &Notifier{}
+
+	if usec != "" &&
+		(watchdogPid == "" || watchdogPid == strconv.Itoa(syscall.Getpid())) {
+		n, err := strconv.ParseInt(usec, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WATCHDOG_USEC: %s", usec)
+		}
+		ret.watchdog = time.Duration(n) * time.Microsecond
+	}
+
+	// abstract namespace socket
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix(
+		"unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("notify socket: %w", err)
+	}
+	ret.conn = conn
+
+	return ret, nil
+}
+
+// Notify sends the given assignments, e.g. "READY=1", to systemd.
+func (this *Notifier) Notify(assignments ...string) error {
+	_, err := this.conn.Write([]byte(strings.Join(assignments, "\n")))
+	return err
+}
+
+// Watchdog returns the watchdog timeout, or zero if it is disabled.
+func (this *Notifier) Watchdog() time.Duration {
+	return this.watchdog
+}
+
+func (this *Notifier) Close() error {
+	return this.conn.Close()
+}
+
+// ListenFilesFromEnv returns the sockets passed by socket activation, by
+// their FileDescriptorName= (the socket unit's name if unset). The
+// variables are unset, so checks run by the daemon don't inherit them.
+func ListenFilesFromEnv() (map[string]*os.File, error) {
+	pid := os.Getenv("LISTEN_PID")
+	fds := os.Getenv("LISTEN_FDS")
+	names := os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if fds == "" || pid != strconv.Itoa(syscall.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %s", fds)
+	}
+
+	nameList := strings.Split(names, ":")
+	ret := make(map[string]*os.File)
+	for i := range n {
+		fd := LISTEN_FDS_START + i
+		closeOnExec(fd)
+
+		name := "unknown"
+		if i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+		ret[name] = os.NewFile(uintptr(fd), name)
+	}
+
+	return ret, nil
+}
+
+// statusSummary describes the health of the sites in a line, for systemctl
+// status.
+func statusSummary(pings []*Ping) string {
+	counts := make(map[State]int)
+	for _, ping := range pings {
+		counts[ping.Status().State]++
+	}
+
+	parts := make([]string, 0)
+	for _, state := range []State{
+		STATE_UP, STATE_DOWN, STATE_UNKNOWN, STATE_PAUSED,
+	} {
+		if counts[state] != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	if len(parts) == 0 {
+		return "no sites"
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// closeOnExec does nothing on other platforms, which have no socket
+// activation to pass descriptors.
+func closeOnExec(fd int) {}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/avail/config"
+)
+
+func TestNotifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram(
+		"unixgram", &net.UnixAddr{Name: path, Net: "unixgram"},
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "200000")
+
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer notifier.Close()
+
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		t.Fatal("NOTIFY_SOCKET must be unset for child processes")
+		return
+	}
+	if notifier.Watchdog() != 200*time.Millisecond {
+		t.Fatalf("unexpected watchdog: %s", notifier.Watchdog())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	d := NewDaemon(&config.Config{
+		Sites: []config.Ping{
+			{Title: "a", Url: srv.URL, Interval: "1s", Timeout: "1s"},
+		},
+	}, DaemonWithNotifier(notifier), DaemonWithPidDir(t.TempDir()))
+	err = d.apply(ctx, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	go d.runNotifier(ctx)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		msg := string(buf[:n])
+		if !strings.Contains(msg, "WATCHDOG=1") {
+			t.Fatalf("expected watchdog ping, got %q", msg)
+			return
+		}
+		if strings.Contains(msg, "STATUS=1 up") {
+			break
+		}
+	}
+
+	cancel()
+	d.wg.Wait()
+}
+
+func TestListenFilesFromEnv(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	files, err := ListenFilesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(files) != 0 {
+		t.Fatal("sockets passed to another process must be ignored")
+		return
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("LISTEN_FDS must be unset for child processes")
+		return
+	}
+}
+
+func TestWatchdogStuckSite(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram(
+		"unixgram", &net.UnixAddr{Name: path, Net: "unixgram"},
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "100000")
+
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	defer notifier.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	dir := t.TempDir()
+	check := &blockingCheck{release: make(chan struct{})}
+	ping, err := NewPing(
+		"stuck", srv.URL, PingWithPath(filepath.Join(dir, "stuck")),
+		PingWithInterval(100*time.Millisecond),
+		PingWithTimeout(100*time.Millisecond), PingWithCheck(check),
+	)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	cfg := config.Ping{Title: "stuck", Url: srv.URL}
+	d := NewDaemon(
+		&config.Config{Sites: []config.Ping{cfg}},
+		DaemonWithNotifier(notifier), DaemonWithPidDir(dir),
+	)
+	d.mu.Lock()
+	d.siteCfgs = d.cfg.Sites
+	d.startSite(ctx, cfg, ping, nil)
+	d.mu.Unlock()
+
+	go d.runNotifier(ctx)
+
+	// waits for a notification with or without a watchdog ping
+	expect := func(watchdog bool) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("expected watchdog=%t: %s", watchdog, err)
+				return
+			}
+			if strings.Contains(string(buf[:n]), "WATCHDOG=1") == watchdog {
+				return
+			}
+		}
+	}
+
+	expect(false)
+	close(check.release)
+	expect(true)
+
+	cancel()
+	d.wg.Wait()
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	KEY_UP    = "up"
+	KEY_DOWN  = "down"
+	KEY_ENTER = "enter"
+	KEY_ESC   = "esc"
+	KEY_BACK  = "backspace"
+	KEY_CTRLC = "ctrl-c"
+)
+
+const SPARKLINE_SIZE = 20
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+var topSorts = []string{"state", "title", "latency", "changed"}
+
+var topFilters = []State{"", STATE_DOWN, STATE_UP, STATE_UNKNOWN, STATE_PAUSED}
+
+type TopOption = func(top *Top)
+
+func NewTop(pid int, opts ...TopOption) *Top {
+	base := &Top{
+		pid:     pid,
+		client:  Connect(pid),
+		in:      os.Stdin,
+		out:     os.Stdout,
+		refresh: time.Second,
+	}
+
+	for _, o := range opts {
+		o(base)
+	}
+
+	return base
+}
+
+func TopWithRefresh(refresh time.Duration) TopOption {
+	return func(top *Top) {
+		top.refresh = refresh
+	}
+}
+
+// TopWithSelector only shows the selected sites.
+func TopWithSelector(selector *Selector) TopOption {
+	return func(top *Top) {
+		top.selector = selector
+	}
+}
+
+type topRow struct {
+	status  *SiteStatus
+	history []Sample
+}
+
+// Top is a full screen, continuously refreshing view of the running
+// daemon's sites.
+type Top struct {
+	pid     int
+	client  Client
+	in      *os.File
+	out     io.Writer
+	refresh time.Duration
+	// nil shows every site
+	selector *Selector
+
+	rows []topRow
+	err  error
+
+	selected  int
+	offset    int
+	sort      int
+	filter    int
+	search    string
+	searching bool
+	// labels is the tag selector entered with l, narrowing down the sites
+	// of selector, see ParseSelector
+	labels   string
+	labeling bool
+	tags     *Selector
+	message  string
+}
+
+func (this *Top) Run(ctx context.Context) error {
+	fd := int(this.in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("avail top must be run in a terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	// alternate screen, hidden cursor
+	fmt.Fprint(this.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(this.out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go this.readKeys(keys)
+
+	winch := make(chan os.Signal, 1)
+	notifyResize(winch)
+	defer signal.Stop(winch)
+
+	ticker := time.NewTicker(this.refresh)
+	defer ticker.Stop()
+
+	this.load()
+	for {
+		this.draw()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-winch:
+		case <-ticker.C:
+			this.load()
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if this.handleKey(key) {
+				return nil
+			}
+		}
+	}
+}
+
+func (this *Top) readKeys(keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 64)
+	for {
+		n, err := this.in.Read(buf)
+		if err != nil {
+			return
+		}
+
+		b := buf[:n]
+		for len(b) > 0 {
+			switch {
+			case bytes.HasPrefix(b, []byte("\x1b[A")):
+				keys <- KEY_UP
+				b = b[3:]
+			case bytes.HasPrefix(b, []byte("\x1b[B")):
+				keys <- KEY_DOWN
+				b = b[3:]
+			case bytes.HasPrefix(b, []byte("\x1b[")):
+				// unsupported escape sequence
+				b = nil
+			case b[0] == 0x1b:
+				keys <- KEY_ESC
+				b = b[1:]
+			case b[0] == '\r' || b[0] == '\n':
+				keys <- KEY_ENTER
+				b = b[1:]
+			case b[0] == 0x7f || b[0] == 0x08:
+				keys <- KEY_BACK
+				b = b[1:]
+			case b[0] == 0x03:
+				keys <- KEY_CTRLC
+				b = b[1:]
+			default:
+				r, size := utf8.DecodeRune(b)
+				keys <- string(r)
+				b = b[size:]
+			}
+		}
+	}
+}
+
+// handleKey applies a key press and reports whether top should exit.
+func (this *Top) handleKey(key string) bool {
+	if key == KEY_CTRLC {
+		return true
+	}
+
+	if this.searching {
+		switch key {
+		case KEY_ENTER:
+			this.searching = false
+		case KEY_ESC:
+			this.searching = false
+			this.search = ""
+		default:
+			this.search = edit(this.search, key)
+		}
+		this.selected = 0
+		return false
+	}
+
+	if this.labeling {
+		this.message = ""
+		switch key {
+		case KEY_ENTER:
+			// an invalid selector stays open for corrections
+			this.labeling = !this.selectTags()
+		case KEY_ESC:
+			this.labeling = false
+			this.labels = ""
+			this.tags = nil
+		default:
+			this.labels = edit(this.labels, key)
+		}
+		this.selected = 0
+		return false
+	}
+
+	this.message = ""
+	switch key {
+	case "q":
+		return true
+	case KEY_UP, "k":
+		this.selected--
+	case KEY_DOWN, "j":
+		this.selected++
+	case "s":
+		this.sort = (this.sort + 1) % len(topSorts)
+	case "f":
+		this.filter = (this.filter + 1) % len(topFilters)
+		this.selected = 0
+	case "/":
+		this.searching = true
+	case "l":
+		this.labeling = true
+	case KEY_ESC:
+		this.search = ""
+		this.labels = ""
+		this.tags = nil
+	case "r":
+		this.request(REQUEST_CHECK)
+	case "p":
+		row := this.current()
+		if row != nil && row.status.State == STATE_PAUSED {
+			this.request(REQUEST_RESUME)
+		} else {
+			this.request(REQUEST_PAUSE)
+		}
+	}
+
+	return false
+}
+
+// edit applies a key press to the text typed at a prompt.
+func edit(text, key string) string {
+	switch {
+	case key == KEY_BACK:
+		_, size := utf8.DecodeLastRuneInString(text)
+		return text[:len(text)-size]
+	case utf8.RuneCountInString(key) == 1:
+		return text + key
+	default:
+		return text
+	}
+}
+
+// selectTags parses the entered tag selector and reports whether it is
+// valid, the previous one is kept otherwise.
+func (this *Top) selectTags() bool {
+	tags, err := ParseSelector(this.labels, "")
+	if err != nil {
+		this.message = fmt.Sprintf("error: %v", err)
+		return false
+	}
+
+	this.tags = tags
+	return true
+}
+
+func (this *Top) request(request string) {
+	row := this.current()
+	if row == nil {
+		return
+	}
+
+	err := this.client.Request(row.status.Title, request)
+	if err != nil {
+		this.message = fmt.Sprintf("error: %v", err)
+		return
+	}
+
+	this.message = fmt.Sprintf("sent %s request to %s", request, row.status.Title)
+}
+
+func (this *Top) load() {
+	statuses, err := this.client.SitesStatus(nil)
+	if err != nil {
+		this.err = err
+		return
+	}
+	if this.selector != nil {
+		statuses = this.selector.Filter(statuses)
+	}
+
+	rows := make([]topRow, 0, len(statuses))
+	for _, s := range statuses {
+		// sites may come and go while reading
+		h, err := this.client.History(s.Title)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, topRow{s, h})
+	}
+
+	this.rows = rows
+	this.err = nil
+}
+
+// visible returns the filtered and sorted rows.
+func (this *Top) visible() []topRow {
+	filter := topFilters[this.filter]
+
+	ret := make([]topRow, 0, len(this.rows))
+	for _, r := range this.rows {
+		if filter != "" && r.status.State != filter {
+			continue
+		}
+		if this.search != "" &&
+			!strings.Contains(r.status.Title, this.search) {
+			continue
+		}
+		if this.tags != nil && !this.tags.Matches(r.status.SiteEntry) {
+			continue
+		}
+		ret = append(ret, r)
+	}
+
+	slices.SortStableFunc(ret, func(a, b topRow) int {
+		switch topSorts[this.sort] {
+		case "state":
+			c := stateOrder(a.status.State) - stateOrder(b.status.State)
+			if c != 0 {
+				return c
+			}
+		case "latency":
+			c := b.status.Latency - a.status.Latency
+			if c != 0 {
+				return int(c)
+			}
+		case "changed":
+			c := b.status.Since.Compare(a.status.Since)
+			if c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.status.Title, b.status.Title)
+	})
+
+	return ret
+}
+
+// stateOrder puts the states needing attention first.
+func stateOrder(state State) int {
+	switch state {
+	case STATE_DOWN:
+		return 0
+	case STATE_UNKNOWN:
+		return 1
+	case STATE_PAUSED:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (this *Top) current() *topRow {
+	rows := this.visible()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return &rows[max(0, min(this.selected, len(rows)-1))]
+}
+
+func (this *Top) draw() {
+	width, height, err := term.GetSize(int(this.in.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	rows := this.visible()
+	this.selected = max(0, min(this.selected, len(rows)-1))
+
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(s)
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	up, down := 0, 0
+	for _, r := range this.rows {
+		switch r.status.State {
+		case STATE_UP:
+			up++
+		case STATE_DOWN:
+			down++
+		}
+	}
+
+	b.WriteString("\x1b[H")
+	line(fit(fmt.Sprintf(
+		"avail top - PID %d - %d sites, %s%d up%s, %s%d down%s",
+		this.pid, len(this.rows),
+		STATE_UP.Color(), up, COLOR_RESET,
+		STATE_DOWN.Color(), down, COLOR_RESET,
+	), width))
+
+	filter := string(topFilters[this.filter])
+	if filter == "" {
+		filter = "all"
+	}
+	search := this.search
+	if this.searching {
+		search += "_"
+	}
+	labels := this.labels
+	if this.labeling {
+		labels += "_"
+	}
+	line(fit(fmt.Sprintf(
+		"sort: %s  state: %s  search: %s  tags: %s",
+		topSorts[this.sort], filter, search, labels,
+	), width))
+	line("")
+
+	titleLength := len("TITLE")
+	for _, r := range rows {
+		titleLength = max(titleLength, len(r.status.Title))
+	}
+	// marker, title, state, latency, history, changed
+	fixed := 2 + titleLength + 1 + 8 + 1 + 9 + 1 + SPARKLINE_SIZE + 1 + 9 + 1
+	errLength := max(0, width-fixed)
+
+	line(fit(fmt.Sprintf(
+		"  %-*s %-8s %9s %-*s %-9s %s",
+		titleLength, "TITLE", "STATE", "LATENCY",
+		SPARKLINE_SIZE, "HISTORY", "CHANGED", "ERROR",
+	), width))
+
+	// header lines above and status line below
+	capacity := max(1, height-5)
+	if this.selected < this.offset {
+		this.offset = this.selected
+	}
+	if this.selected >= this.offset+capacity {
+		this.offset = this.selected - capacity + 1
+	}
+	this.offset = max(0, min(this.offset, len(rows)-1))
+
+	for i := this.offset; i < len(rows) && i < this.offset+capacity; i++ {
+		marker := "  "
+		if i == this.selected {
+			marker = "> "
+		}
+
+		s := rows[i].status
+		changed := "-"
+		if !s.Since.IsZero() {
+			changed = formatDuration(time.Since(s.Since))
+		}
+
+		line(fit(fmt.Sprintf(
+			"%s%-*s %s%-8s%s %9s %s %-9s %s",
+			marker, titleLength, s.Title,
+			s.State.Color(), s.State.Label(), COLOR_RESET,
+			fmt.Sprintf("%d ms", s.Latency),
+			sparkline(rows[i].history, SPARKLINE_SIZE),
+			changed,
+			truncate(strings.ReplaceAll(s.Error, "\n", " "), errLength),
+		), width))
+	}
+
+	b.WriteString("\x1b[J")
+
+	status := "q quit  j/k move  r re-check  p pause/resume  s sort  f state  / search  l tags"
+	if this.err != nil {
+		status = fmt.Sprintf("error: %v", this.err)
+	} else if this.message != "" {
+		status = this.message
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", height, fit(status, width))
+
+	io.WriteString(this.out, b.String())
+}
+
+// sparkline renders the latencies of the last n samples, scaled to the
+// slowest of them. Failed checks are drawn in red.
+func sparkline(history []Sample, n int) string {
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+
+	var highest int64 = 1
+	for _, s := range history {
+		highest = max(highest, s.Latency)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", n-len(history)))
+	for _, s := range history {
+		spark := sparks[int(s.Latency*int64(len(sparks)-1)/highest)]
+		if s.Health {
+			b.WriteRune(spark)
+		} else {
+			b.WriteString(STATE_DOWN.Color())
+			b.WriteRune(spark)
+			b.WriteString(COLOR_RESET)
+		}
+	}
+
+	return b.String()
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 1 {
+		return ""
+	}
+
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// fit cuts a line containing ANSI escape sequences to the given visible
+// width.
+func fit(s string, width int) string {
+	var b strings.Builder
+
+	visible := 0
+	escape := false
+	for _, r := range s {
+		switch {
+		case escape:
+			b.WriteRune(r)
+			if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+				escape = false
+			}
+		case r == '\x1b':
+			b.WriteRune(r)
+			escape = true
+		case visible < width:
+			b.WriteRune(r)
+			visible++
+		}
+	}
+
+	return b.String()
+}
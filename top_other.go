@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyResize does nothing on other platforms, where the next refresh
+// picks up the new size of the terminal.
+func notifyResize(c chan<- os.Signal) {}
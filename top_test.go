@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// topClient records the requests sent by top.
+type topClient struct {
+	requests []string
+}
+
+var _ Client = (*topClient)(nil)
+
+func (this *topClient) Titles() ([]string, error) { return nil, nil }
+
+func (this *topClient) SiteEntry(title string) (SiteEntry, error) {
+	return SiteEntry{}, nil
+}
+
+func (this *topClient) SitesStatus(titles []string) (SiteStatusList, error) {
+	return nil, nil
+}
+
+func (this *topClient) History(title string) ([]Sample, error) { return nil, nil }
+
+func (this *topClient) Request(title, request string) error {
+	this.requests = append(this.requests, title+" "+request)
+	return nil
+}
+
+func (this *topClient) CheckNow(ctx context.Context, title string) (SiteStatus, error) {
+	return SiteStatus{}, nil
+}
+
+func (this *topClient) Reload() error { return nil }
+
+func (this *topClient) Shutdown() error { return nil }
+
+func newTestTop() (*Top, *topClient) {
+	now := time.Now()
+	row := func(title string, state State, latency int64, since time.Duration) topRow {
+		return topRow{status: &SiteStatus{
+			SiteEntry: SiteEntry{Title: title},
+			State:     state,
+			Latency:   latency,
+			Since:     now.Add(-since),
+		}}
+	}
+
+	client := &topClient{}
+	return &Top{client: client, rows: []topRow{
+		row("web", STATE_UP, 30, time.Hour),
+		row("api", STATE_DOWN, 10, time.Minute),
+		row("db", STATE_PAUSED, 50, 2*time.Hour),
+		row("cdn", STATE_UP, 20, time.Second),
+	}}, client
+}
+
+func topTitles(rows []topRow) []string {
+	ret := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ret = append(ret, r.status.Title)
+	}
+	return ret
+}
+
+func TestTopVisible(t *testing.T) {
+	top, _ := newTestTop()
+
+	for _, tc := range []struct {
+		sort     string
+		expected []string
+	}{
+		{"state", []string{"api", "db", "cdn", "web"}},
+		{"title", []string{"api", "cdn", "db", "web"}},
+		{"latency", []string{"db", "web", "cdn", "api"}},
+		{"changed", []string{"cdn", "api", "web", "db"}},
+	} {
+		top.sort = slices.Index(topSorts, tc.sort)
+		got := topTitles(top.visible())
+		if !slices.Equal(got, tc.expected) {
+			t.Fatalf("sort %s: expected %v, got %v", tc.sort, tc.expected, got)
+			return
+		}
+	}
+
+	top.sort = slices.Index(topSorts, "title")
+	top.filter = slices.Index(topFilters, STATE_UP)
+	if got := topTitles(top.visible()); !slices.Equal(got, []string{"cdn", "web"}) {
+		t.Fatalf("unexpected filtered rows: %v", got)
+		return
+	}
+
+	top.filter = 0
+	top.search = "d"
+	if got := topTitles(top.visible()); !slices.Equal(got, []string{"cdn", "db"}) {
+		t.Fatalf("unexpected searched rows: %v", got)
+		return
+	}
+}
+
+func TestTopHandleKey(t *testing.T) {
+	top, client := newTestTop()
+
+	if !top.handleKey("q") || !top.handleKey(KEY_CTRLC) {
+		t.Fatal("expected q and ctrl-c to quit")
+		return
+	}
+
+	top.handleKey("s")
+	if topSorts[top.sort] != "title" {
+		t.Fatalf("unexpected sort: %s", topSorts[top.sort])
+		return
+	}
+	top.handleKey("f")
+	if topFilters[top.filter] != STATE_DOWN {
+		t.Fatalf("unexpected filter: %s", topFilters[top.filter])
+		return
+	}
+	for range len(topFilters) - 1 {
+		top.handleKey("f")
+	}
+	if top.filter != 0 {
+		t.Fatal("expected the filter to cycle back to all states")
+		return
+	}
+
+	for _, key := range []string{"/", "w", "x", KEY_BACK, "e"} {
+		if top.handleKey(key) {
+			t.Fatalf("%s must not quit while searching", key)
+			return
+		}
+	}
+	if !top.searching || top.search != "we" {
+		t.Fatalf("unexpected search: %q", top.search)
+		return
+	}
+	top.handleKey(KEY_ENTER)
+	if top.searching || top.search != "we" {
+		t.Fatal("expected enter to keep the search")
+		return
+	}
+	top.handleKey(KEY_ESC)
+	if top.search != "" {
+		t.Fatal("expected esc to clear the search")
+		return
+	}
+
+	// api, cdn, db, web by title
+	top.handleKey("j")
+	top.handleKey("r")
+	top.handleKey("j")
+	top.handleKey("p")
+	top.handleKey(KEY_UP)
+	top.handleKey("p")
+	expected := []string{
+		"cdn " + REQUEST_CHECK, "db " + REQUEST_RESUME, "cdn " + REQUEST_PAUSE,
+	}
+	if !slices.Equal(client.requests, expected) {
+		t.Fatalf("expected %v, got %v", expected, client.requests)
+		return
+	}
+	if !strings.Contains(top.message, "cdn") {
+		t.Fatalf("unexpected message: %s", top.message)
+		return
+	}
+}
+
+func TestTopTags(t *testing.T) {
+	top, _ := newTestTop()
+	top.rows[0].status.Tags = map[string]string{"env": "prod"}
+	top.rows[1].status.Tags = map[string]string{"env": "dev"}
+
+	for _, key := range []string{"l", "=", "x", KEY_ENTER} {
+		top.handleKey(key)
+	}
+	if !top.labeling || !strings.Contains(top.message, "invalid selector") {
+		t.Fatalf("expected an invalid selector to stay open, got %q", top.message)
+		return
+	}
+
+	for _, key := range []string{
+		KEY_BACK, KEY_BACK, "e", "n", "v", "=", "p", "r", "o", "d", KEY_ENTER,
+	} {
+		top.handleKey(key)
+	}
+	if top.labeling {
+		t.Fatal("expected enter to apply the selector")
+		return
+	}
+	if got := topTitles(top.visible()); !slices.Equal(got, []string{"web"}) {
+		t.Fatalf("unexpected selected rows: %v", got)
+		return
+	}
+
+	top.handleKey(KEY_ESC)
+	if len(top.visible()) != len(top.rows) {
+		t.Fatal("expected esc to clear the selector")
+		return
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	history := []Sample{
+		{Latency: 0, Health: true},
+		{Latency: 50, Health: true},
+		{Latency: 100, Health: true},
+		{Latency: 100, Health: false},
+	}
+
+	s := sparkline(history, 6)
+	expected := "  ▁▄█" + STATE_DOWN.Color() + "█" + COLOR_RESET
+	if s != expected {
+		t.Fatalf("expected %q, got %q", expected, s)
+		return
+	}
+
+	if s := sparkline(history, 2); s != "█"+STATE_DOWN.Color()+"█"+COLOR_RESET {
+		t.Fatalf("expected the last samples only, got %q", s)
+		return
+	}
+}
+
+func TestFit(t *testing.T) {
+	colored := STATE_UP.Color() + "up" + COLOR_RESET + " since"
+	if s := fit(colored, 4); s != STATE_UP.Color()+"up"+COLOR_RESET+" s" {
+		t.Fatalf("escape sequences must not count: %q", s)
+		return
+	}
+	if s := fit("héllo", 10); s != "héllo" {
+		t.Fatalf("unexpected fit: %q", s)
+		return
+	}
+
+	for _, tc := range []struct {
+		in       string
+		n        int
+		expected string
+	}{
+		{"timeout", 10, "timeout"},
+		{"timeout", 7, "timeout"},
+		{"timeout", 5, "time…"},
+		{"héllo wörld", 4, "hél…"},
+		{"timeout", 1, ""},
+	} {
+		if s := truncate(tc.in, tc.n); s != tc.expected {
+			t.Fatalf("truncate(%q, %d): expected %q, got %q", tc.in, tc.n, tc.expected, s)
+			return
+		}
+	}
+}